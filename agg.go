@@ -0,0 +1,231 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "bytes"
+
+// AggTree is a radix tree that maintains an aggregate of the values in every
+// subtree, so the aggregate of all the values under any prefix can be read in
+// O(depth) without visiting them. Aggregates are described by a monoid: a zero
+// value, an associative combine function and a lift function that turns a
+// single value into an aggregate. For example, a sum of int values would use
+// zero 0, combine a+b and lift v.
+//
+// The aggregates are kept alongside the tree rather than in its nodes, and are
+// recomputed when a transaction is committed for just the nodes it copied, so
+// unchanged subtrees keep their aggregates and are shared with earlier
+// versions of the tree just like in a regular Tree. Values are combined in key
+// order, so combine doesn't need to be commutative.
+type AggTree[T, A any] struct {
+	tree *Tree[T]
+	m    *monoid[T, A]
+	aggs *aggNode[T, A]
+}
+
+// monoid holds the functions used to maintain an AggTree's aggregates.
+type monoid[T, A any] struct {
+	zero    A
+	combine func(a, b A) A
+	lift    func(v T) A
+}
+
+// NewAggTree returns an empty AggTree using the given monoid.
+func NewAggTree[T, A any](zero A, combine func(a, b A) A, lift func(v T) A) *AggTree[T, A] {
+	t := &AggTree[T, A]{
+		tree: New[T](),
+		m: &monoid[T, A]{
+			zero:    zero,
+			combine: combine,
+			lift:    lift,
+		},
+	}
+	t.aggs = t.m.build(t.tree.root, nil, nil, 0)
+	return t
+}
+
+// aggNode holds the aggregate for a node of an AggTree's underlying tree. The
+// aggNodes form a tree of their own that mirrors the nodes, with children in
+// the same order as the node's edges, so plain trees don't pay for the
+// aggregates in every node.
+type aggNode[T, A any] struct {
+	*Node[T]
+	agg      A
+	children []*aggNode[T, A]
+}
+
+// build returns the aggregates for the tree under n, whose path from the root
+// down to its parent is given. Like the tree, this is copy-on-write: prev is
+// the mirror of the tree that n's was changed from, positioned at the deepest
+// node whose path is the first depth bytes of n's path, and any node that's
+// unchanged since then keeps the aggNode it had there. Only the nodes that were
+// copied, and their children, are visited.
+func (m *monoid[T, A]) build(n *Node[T], path []byte, prev *aggNode[T, A], depth int) *aggNode[T, A] {
+	path = append(path, n.prefix...)
+	if prev != nil {
+		prev, depth = prev.descend(path, depth)
+		if depth == len(path) && prev.Node == n {
+			return prev
+		}
+	}
+
+	a := &aggNode[T, A]{Node: n, agg: m.zero}
+	if n.leaf != nil {
+		a.agg = m.combine(a.agg, m.lift(n.leaf.val))
+	}
+	if len(n.edges) != 0 {
+		a.children = make([]*aggNode[T, A], len(n.edges))
+	}
+	for i, e := range n.edges {
+		a.children[i] = m.build(e.node, path, prev, depth)
+		a.agg = m.combine(a.agg, a.children[i].agg)
+	}
+	return a
+}
+
+// descend follows path down from a, which is at the first depth bytes of it,
+// and returns the deepest node whose path is a prefix of path, along with the
+// length of that node's path. A node's path only depends on the keys under it,
+// so an unchanged node is always found at the same path.
+func (a *aggNode[T, A]) descend(path []byte, depth int) (*aggNode[T, A], int) {
+	for depth < len(path) {
+		idx, _ := a.getEdge(path[depth])
+		if idx < 0 {
+			break
+		}
+		c := a.children[idx]
+		if !bytes.HasPrefix(path[depth:], c.prefix) {
+			break
+		}
+		a, depth = c, depth+len(c.prefix)
+	}
+	return a, depth
+}
+
+// aggregate returns the aggregate of all the values whose keys start with the
+// given prefix, or the zero aggregate if there are none. This follows the same
+// steps as Node.prefixNode.
+func (m *monoid[T, A]) aggregate(a *aggNode[T, A], prefix []byte) A {
+	search := prefix
+	for len(search) != 0 {
+		idx, _ := a.getEdge(search[0])
+		if idx < 0 {
+			return m.zero
+		}
+		a = a.children[idx]
+		if bytes.HasPrefix(search, a.prefix) {
+			search = search[len(a.prefix):]
+		} else if bytes.HasPrefix(a.prefix, search) {
+			break
+		} else {
+			return m.zero
+		}
+	}
+	return a.agg
+}
+
+// Len is used to return the number of elements in the tree
+func (t *AggTree[T, A]) Len() int {
+	return t.tree.Len()
+}
+
+// Tree returns the underlying tree, which can be used for all the usual read
+// operations.
+func (t *AggTree[T, A]) Tree() *Tree[T] {
+	return t.tree
+}
+
+// Get is used to lookup a specific key, returning
+// the value and if it was found
+func (t *AggTree[T, A]) Get(k []byte) (T, bool) {
+	return t.tree.Get(k)
+}
+
+// Aggregate returns the aggregate of all the values whose keys start with the
+// given prefix, or the zero aggregate if there are none. An empty prefix gives
+// the aggregate of the whole tree.
+func (t *AggTree[T, A]) Aggregate(prefix []byte) A {
+	return t.m.aggregate(t.aggs, prefix)
+}
+
+// Insert is used to add or update a given key. The return provides
+// the new tree, previous value and a bool indicating if any was set.
+func (t *AggTree[T, A]) Insert(k []byte, v T) (*AggTree[T, A], T, bool) {
+	txn := t.Txn()
+	old, ok := txn.Insert(k, v)
+	return txn.Commit(), old, ok
+}
+
+// Delete is used to delete a given key. Returns the new tree,
+// old value if any, and a bool indicating if the key was set.
+func (t *AggTree[T, A]) Delete(k []byte) (*AggTree[T, A], T, bool) {
+	txn := t.Txn()
+	old, ok := txn.Delete(k)
+	return txn.Commit(), old, ok
+}
+
+// AggTxn is a transaction on an AggTree, which maintains the tree's aggregates
+// as it's modified. Like Txn it is not thread safe.
+type AggTxn[T, A any] struct {
+	txn *Txn[T]
+	m   *monoid[T, A]
+
+	// base holds the aggregates for the tree the transaction started from.
+	base *aggNode[T, A]
+}
+
+// Txn starts a new transaction that can be used to mutate the tree
+func (t *AggTree[T, A]) Txn() *AggTxn[T, A] {
+	return &AggTxn[T, A]{
+		txn:  t.tree.Txn(),
+		m:    t.m,
+		base: t.aggs,
+	}
+}
+
+// TrackMutate can be used to toggle if mutations are tracked, see
+// Txn.TrackMutate.
+func (t *AggTxn[T, A]) TrackMutate(track bool) {
+	t.txn.TrackMutate(track)
+}
+
+// Insert is used to add or update a given key. The return provides
+// the previous value and a bool indicating if any was set.
+func (t *AggTxn[T, A]) Insert(k []byte, v T) (T, bool) {
+	return t.txn.Insert(k, v)
+}
+
+// Delete is used to delete a given key. Returns the old value if any,
+// and a bool indicating if the key was set.
+func (t *AggTxn[T, A]) Delete(k []byte) (T, bool) {
+	return t.txn.Delete(k)
+}
+
+// DeletePrefix is used to delete an entire subtree that matches the prefix
+func (t *AggTxn[T, A]) DeletePrefix(prefix []byte) bool {
+	return t.txn.DeletePrefix(prefix)
+}
+
+// Get is used to lookup a specific key, returning
+// the value and if it was found
+func (t *AggTxn[T, A]) Get(k []byte) (T, bool) {
+	return t.txn.Get(k)
+}
+
+// Aggregate returns the aggregate of all the values whose keys start with the
+// given prefix in the current state of the transaction. The aggregates for the
+// nodes changed so far are worked out again on each call.
+func (t *AggTxn[T, A]) Aggregate(prefix []byte) A {
+	return t.m.aggregate(t.m.build(t.txn.root, nil, t.base, 0), prefix)
+}
+
+// Commit is used to finalize the transaction and return a new tree. If mutation
+// tracking is turned on then notifications will also be issued.
+func (t *AggTxn[T, A]) Commit() *AggTree[T, A] {
+	tree := t.txn.Commit()
+	return &AggTree[T, A]{
+		tree: tree,
+		m:    t.m,
+		aggs: t.m.build(tree.root, nil, t.base, 0),
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestAggTree_Sum(t *testing.T) {
+	sum := func() *AggTree[int, int] {
+		return NewAggTree(0, func(a, b int) int { return a + b }, func(v int) int { return v })
+	}
+
+	r := sum()
+	for k, v := range map[string]int{
+		"tenant.a.cpu":    1,
+		"tenant.a.mem":    2,
+		"tenant.ab.cpu":   4,
+		"tenant.b.cpu":    8,
+		"tenant.b":        16,
+		"other.something": 32,
+	} {
+		r, _, _ = r.Insert([]byte(k), v)
+	}
+
+	type exp struct {
+		prefix string
+		out    int
+	}
+	cases := []exp{
+		{"", 63},
+		{"tenant.", 31},
+		{"tenant.a", 7},
+		{"tenant.a.", 3},
+		{"tenant.b", 24},
+		{"tenant.b.", 8},
+		{"t", 31},
+		{"tenant.c", 0},
+		{"other.something.more", 0},
+	}
+	check := func(r *AggTree[int, int]) {
+		t.Helper()
+		for _, test := range cases {
+			if got := r.Aggregate([]byte(test.prefix)); got != test.out {
+				t.Fatalf("bad: %q got %d want %d", test.prefix, got, test.out)
+			}
+		}
+	}
+	check(r)
+
+	// Keep the old snapshot and make sure it's unaffected by later changes.
+	old := r
+	r, _, _ = r.Insert([]byte("tenant.a.mem"), 102)
+	r, _, _ = r.Delete([]byte("tenant.b"))
+	r, _, _ = r.Delete([]byte("tenant.ab.cpu"))
+	cases = []exp{
+		{"", 143},
+		{"tenant.", 111},
+		{"tenant.a", 103},
+		{"tenant.b", 8},
+		{"tenant.ab", 0},
+	}
+	check(r)
+
+	cases = []exp{{"", 63}, {"tenant.a", 7}}
+	check(old)
+
+	txn := r.Txn()
+	txn.DeletePrefix([]byte("tenant.a"))
+	if got := txn.Aggregate([]byte("tenant.")); got != 8 {
+		t.Fatalf("bad: %d", got)
+	}
+	r = txn.Commit()
+	cases = []exp{{"", 40}, {"tenant.", 8}}
+	check(r)
+}
+
+func TestAggTree_Max(t *testing.T) {
+	max := func(a, b int) int {
+		if a > b {
+			return a
+		}
+		return b
+	}
+	r := NewAggTree(-1, max, func(v int) int { return v })
+
+	// Compare against a brute force scan as keys come and go.
+	rnd := rand.New(rand.NewSource(1))
+	expect := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		k := string([]byte{"abc"[rnd.Intn(3)], "abc"[rnd.Intn(3)], "abc"[rnd.Intn(3)]})[:1+rnd.Intn(3)]
+		if rnd.Intn(3) == 0 {
+			r, _, _ = r.Delete([]byte(k))
+			delete(expect, k)
+		} else {
+			v := rnd.Intn(1000)
+			r, _, _ = r.Insert([]byte(k), v)
+			expect[k] = v
+		}
+
+		for _, prefix := range []string{"", "a", "b", "ab", "abc", "ca"} {
+			want := -1
+			for k, v := range expect {
+				if strings.HasPrefix(k, prefix) {
+					want = max(want, v)
+				}
+			}
+			if got := r.Aggregate([]byte(prefix)); got != want {
+				t.Fatalf("bad: %d %q got %d want %d", i, prefix, got, want)
+			}
+		}
+	}
+}
+
+func TestAggTree_SharesUnchanged(t *testing.T) {
+	calls := 0
+	r := NewAggTree(0, func(a, b int) int { return a + b }, func(v int) int {
+		calls++
+		return v
+	})
+	for i, k := range []string{"a.x", "a.y", "b.x", "b.y", "b.z"} {
+		r, _, _ = r.Insert([]byte(k), i+1)
+	}
+
+	// A change under "a." only recomputes the aggregates on its path, so
+	// only the new value is lifted, and the ones for "b." are shared with
+	// the old tree.
+	calls = 0
+	r2, _, _ := r.Insert([]byte("a.z"), 10)
+	if calls != 1 {
+		t.Fatalf("bad: %d", calls)
+	}
+	find := func(r *AggTree[int, int], k string) *aggNode[int, int] {
+		a, depth := r.aggs.descend([]byte(k), 0)
+		if depth != len(k) {
+			t.Fatalf("bad: %q", k)
+		}
+		return a
+	}
+	if find(r, "b.") != find(r2, "b.") {
+		t.Fatalf("expected the aggregates to be shared")
+	}
+	if find(r, "a.") == find(r2, "a.") {
+		t.Fatalf("expected new aggregates")
+	}
+	if r.Aggregate([]byte("a.")) != 3 || r2.Aggregate([]byte("a.")) != 13 || r2.Aggregate(nil) != 25 {
+		t.Fatalf("bad: %d %d %d", r.Aggregate([]byte("a.")), r2.Aggregate([]byte("a.")), r2.Aggregate(nil))
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+// ErrLengthMismatch is returned by FromSlices when it's given a different
+// number of keys and values.
+var ErrLengthMismatch = errors.New("keys and values have different lengths")
+
+// FromSlices builds a tree from parallel slices of keys and values, so that
+// keys[i] maps to values[i]. An error is returned if the slices have different
+// lengths. If a key appears more than once the last value for it wins, just as
+// if the entries had been inserted in order. The keys are retained by the tree
+// in the same way as Insert, so they must not be modified afterwards.
+//
+// If the keys are already sorted then the tree is built bottom-up in a single
+// pass without copying any nodes, otherwise they are inserted one at a time in
+// a single transaction.
+func FromSlices[T any](keys [][]byte, values []T) (*Tree[T], error) {
+	t, _, err := fromSlices(keys, values)
+	return t, err
+}
+
+// fromSlices does the work for FromSlices, also returning the number of nodes
+// that had to be copied on the way.
+func fromSlices[T any](keys [][]byte, values []T) (*Tree[T], int, error) {
+	if len(keys) != len(values) {
+		return nil, 0, ErrLengthMismatch
+	}
+
+	sorted := true
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) > 0 {
+			sorted = false
+			break
+		}
+	}
+	if !sorted {
+		txn := New[T]().TxnWithCapacity(len(keys))
+		for i, k := range keys {
+			txn.Insert(k, values[i])
+		}
+		return txn.Commit(), txn.copies, nil
+	}
+
+	// Duplicates are adjacent once sorted, so keep just the last of each.
+	uniqKeys := make([][]byte, 0, len(keys))
+	uniqVals := make([]T, 0, len(values))
+	for i, k := range keys {
+		if i+1 < len(keys) && bytes.Equal(k, keys[i+1]) {
+			continue
+		}
+		uniqKeys = append(uniqKeys, k)
+		uniqVals = append(uniqVals, values[i])
+	}
+
+	return buildTree(uniqKeys, uniqVals), 0, nil
+}
+
+// buildTree builds a tree from the given keys, which must be sorted and free
+// of duplicates, and their values.
+func buildTree[T any](keys [][]byte, values []T) *Tree[T] {
+	root := &Node[T]{mutateCh: make(chan struct{})}
+	buildSorted(root, keys, values, 0)
+	root.wild = wildcardFlagFor(root)
+	return &Tree[T]{root, root.size}
+}
+
+// buildSorted fills in the leaf and children of n, whose path is depth bytes
+// long, from the given keys, which must be sorted, free of duplicates, and all
+// start with n's path.
+func buildSorted[T any](n *Node[T], keys [][]byte, values []T, depth int) {
+	n.size = len(keys)
+
+	// Since the keys are sorted, a key for this node itself comes first.
+	if len(keys) > 0 && len(keys[0]) == depth {
+		n.leaf = &leafNode[T]{
+			mutateCh: make(chan struct{}),
+			key:      keys[0],
+			val:      values[0],
+		}
+		keys, values = keys[1:], values[1:]
+	}
+
+	for len(keys) > 0 {
+		// Gather the run of keys that go under the same edge.
+		label := keys[0][depth]
+		end := 1
+		for end < len(keys) && keys[end][depth] == label {
+			end++
+		}
+
+		// The keys are sorted, so the run's common prefix is the one
+		// shared by its first and last keys.
+		first, last := keys[0], keys[end-1]
+		common := depth + longestPrefix(first[depth:], last[depth:])
+		child := &Node[T]{
+			mutateCh: make(chan struct{}),
+			prefix:   first[depth:common],
+		}
+		buildSorted(child, keys[:end], values[:end], common)
+		n.edges = append(n.edges, edge[T]{label: label, node: child})
+
+		keys, values = keys[end:], values[end:]
+	}
+}
+
+// Entries is a list of entries which can be sorted by key with the sort
+// package, since it implements sort.Interface.
+type Entries[T any] []KV[T]
+
+func (e Entries[T]) Len() int           { return len(e) }
+func (e Entries[T]) Less(i, j int) bool { return bytes.Compare(e[i].Key, e[j].Key) < 0 }
+func (e Entries[T]) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// Entries returns all the entries in the subtree under this node in key
+// order, allocated once at the right size using the cached subtree size. The
+// keys are the stored keys, so they must not be modified.
+func (n *Node[T]) Entries() Entries[T] {
+	out := make(Entries[T], 0, n.size)
+	walkLeaves(n, func(l *leafNode[T]) {
+		out = append(out, KV[T]{l.key, l.val})
+	})
+	return out
+}
+
+// FromEntries builds a tree from the given entries, which works just like
+// FromSlices: if they're already sorted by key the tree is built bottom-up in
+// a single pass, and otherwise they're inserted in order, with the last value
+// winning for a repeated key. Note that sort.Sort isn't stable, so if the
+// entries are sorted first then use sort.Stable to keep the last of any
+// repeated key winning. The keys are retained by the tree like Insert.
+func FromEntries[T any](entries Entries[T]) *Tree[T] {
+	keys := make([][]byte, len(entries))
+	values := make([]T, len(entries))
+	for i, e := range entries {
+		keys[i], values[i] = e.Key, e.Value
+	}
+	t, _, _ := fromSlices(keys, values)
+	return t
+}
+
+// TreeBuilder accumulates entries to build a tree from in one go, keeping
+// track of which keys were added more than once. The zero value is an empty
+// builder ready to use. Like FromSlices, it retains the keys it's given, so
+// they must not be modified afterwards.
+type TreeBuilder[T any] struct {
+	keys   [][]byte
+	values []T
+
+	// index maps each key to its position in keys and values.
+	index map[string]int
+
+	// repeated is set for the positions of keys that have been added more
+	// than once, which are also listed in collisions in the order they were
+	// first repeated.
+	repeated   []bool
+	collisions [][]byte
+}
+
+// Add adds an entry to the builder, returning true if the key had already
+// been added, in which case its value is replaced so that the last one wins.
+func (b *TreeBuilder[T]) Add(k []byte, v T) (replaced bool) {
+	if b.index == nil {
+		b.index = make(map[string]int)
+	}
+	if i, ok := b.index[string(k)]; ok {
+		if !b.repeated[i] {
+			b.repeated[i] = true
+			b.collisions = append(b.collisions, b.keys[i])
+		}
+		b.values[i] = v
+		return true
+	}
+	b.index[string(k)] = len(b.keys)
+	b.keys = append(b.keys, k)
+	b.values = append(b.values, v)
+	b.repeated = append(b.repeated, false)
+	return false
+}
+
+// Len returns the number of distinct keys added so far.
+func (b *TreeBuilder[T]) Len() int {
+	return len(b.keys)
+}
+
+// Collisions returns the keys that have been added more than once, each listed
+// once, in the order they were first repeated.
+func (b *TreeBuilder[T]) Collisions() [][]byte {
+	return b.collisions
+}
+
+// Build returns a tree holding the entries added so far. The entries are
+// sorted and built bottom-up in a single pass, the same as FromSlices with
+// sorted keys, so no nodes are copied. The builder can carry on being used
+// afterwards, and building again includes the new entries too.
+func (b *TreeBuilder[T]) Build() *Tree[T] {
+	order := make([]int, len(b.keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(b.keys[order[i]], b.keys[order[j]]) < 0
+	})
+	keys := make([][]byte, len(order))
+	values := make([]T, len(order))
+	for i, o := range order {
+		keys[i], values[i] = b.keys[o], b.values[o]
+	}
+
+	return buildTree(keys, values)
+}
@@ -0,0 +1,269 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestFromSlices(t *testing.T) {
+	if _, err := FromSlices([][]byte{[]byte("a")}, []int{1, 2}); err != ErrLengthMismatch {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Duplicates resolve to the last value, sorted or not.
+	for _, keys := range [][]string{
+		{"", "a", "a", "b", "b", "b", "c"},
+		{"b", "a", "", "b", "c", "a", "b"},
+	} {
+		var bkeys [][]byte
+		var vals []int
+		for i, k := range keys {
+			bkeys = append(bkeys, []byte(k))
+			vals = append(vals, i)
+		}
+		r, err := FromSlices(bkeys, vals)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if r.Len() != 4 {
+			t.Fatalf("bad: %d", r.Len())
+		}
+		for i, k := range keys {
+			last := i
+			for j := i + 1; j < len(keys); j++ {
+				if keys[j] == k {
+					last = j
+				}
+			}
+			if v, ok := r.Get([]byte(k)); !ok || v != last {
+				t.Fatalf("bad: %q %v %v", k, v, ok)
+			}
+		}
+	}
+
+	// Empty input gives an empty tree.
+	r, err := FromSlices[int](nil, nil)
+	if err != nil || r.Len() != 0 {
+		t.Fatalf("bad: %v", err)
+	}
+	if r, _, _ = r.Insert([]byte("a"), 1); r.Len() != 1 {
+		t.Fatalf("bad: %d", r.Len())
+	}
+}
+
+func TestFromSlices_FastPath(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var keys [][]byte
+	var vals []int
+	for i := 0; i < 5000; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("%x", rnd.Intn(100000))))
+		vals = append(vals, i)
+	}
+
+	// Unsorted input goes through a transaction, which copies nodes.
+	r, copies, err := fromSlices(keys, vals)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if copies == 0 {
+		t.Fatalf("expected the slow path to copy nodes")
+	}
+
+	// Sorted input builds the tree directly.
+	idx := make([]int, len(keys))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return string(keys[idx[i]]) < string(keys[idx[j]]) })
+	var sortedKeys [][]byte
+	var sortedVals []int
+	for _, i := range idx {
+		sortedKeys = append(sortedKeys, keys[i])
+		sortedVals = append(sortedVals, vals[i])
+	}
+	s, copies, err := fromSlices(sortedKeys, sortedVals)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if copies != 0 {
+		t.Fatalf("bad: %d", copies)
+	}
+
+	// Both give the same tree as inserting one at a time.
+	if s.Len() != r.Len() || !sameShape(s.Root(), r.Root()) {
+		t.Fatalf("bad shape")
+	}
+	if diff := DiffString(r, s, strconv.Itoa); diff != "" {
+		t.Fatalf("bad:\n%s", diff)
+	}
+	checkSizes(t, s.Root())
+	checkCanonical(t, s.Root())
+
+	// The built tree can be modified as usual.
+	txn := s.Txn()
+	txn.Delete(sortedKeys[0])
+	txn.Insert([]byte("new"), -1)
+	s2 := txn.Commit()
+	if s2.Len() != s.Len() {
+		t.Fatalf("bad: %d %d", s2.Len(), s.Len())
+	}
+	checkSizes(t, s2.Root())
+	checkCanonical(t, s2.Root())
+}
+
+func TestTreeBuilder(t *testing.T) {
+	var b TreeBuilder[int]
+	empty := b.Build()
+	if empty.Len() != 0 || len(b.Collisions()) != 0 {
+		t.Fatalf("bad: %d %d", empty.Len(), len(b.Collisions()))
+	}
+	empty, _, _ = empty.Insert([]byte("a"), 1)
+	if empty.Len() != 1 {
+		t.Fatalf("bad: %d", empty.Len())
+	}
+
+	adds := []struct {
+		key      string
+		replaced bool
+	}{
+		{"svc.b", false},
+		{"svc.a", false},
+		{"svc.b", true},
+		{"", false},
+		{"svc.a", true},
+		{"svc.b", true},
+		{"svc", false},
+		{"", true},
+	}
+	for i, a := range adds {
+		if replaced := b.Add([]byte(a.key), i); replaced != a.replaced {
+			t.Fatalf("bad: %d %q: %v", i, a.key, replaced)
+		}
+	}
+	if b.Len() != 4 {
+		t.Fatalf("bad: %d", b.Len())
+	}
+	var collisions []string
+	for _, k := range b.Collisions() {
+		collisions = append(collisions, string(k))
+	}
+	if fmt.Sprint(collisions) != "[svc.b svc.a ]" {
+		t.Fatalf("bad: %q", collisions)
+	}
+
+	// The last value for each key wins.
+	r := b.Build()
+	expect := map[string]int{"": 7, "svc": 6, "svc.a": 4, "svc.b": 5}
+	if r.Len() != len(expect) {
+		t.Fatalf("bad: %d", r.Len())
+	}
+	for k, v := range expect {
+		if got, ok := r.Get([]byte(k)); !ok || got != v {
+			t.Fatalf("bad: %q: %d %v", k, got, ok)
+		}
+	}
+	checkCanonical(t, r.Root())
+	checkSizes(t, r.Root())
+
+	// Building again picks up new entries, without changing the first tree.
+	b.Add([]byte("svc.c"), 8)
+	if r2 := b.Build(); r2.Len() != 5 || r.Len() != 4 {
+		t.Fatalf("bad: %d %d", r2.Len(), r.Len())
+	}
+}
+
+func TestTreeBuilder_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for round := 0; round < 100; round++ {
+		var b TreeBuilder[int]
+		txn := New[int]().Txn()
+		seen := make(map[string]int)
+		for i := 0; i < rnd.Intn(50); i++ {
+			k := []byte(strconv.Itoa(rnd.Intn(30)))
+			seen[string(k)]++
+			if replaced := b.Add(k, i); replaced != (seen[string(k)] > 1) {
+				t.Fatalf("bad: %q %v", k, replaced)
+			}
+			txn.Insert(k, i)
+		}
+		expect := txn.Commit()
+
+		r := b.Build()
+		if !sameShape(r.Root(), expect.Root()) {
+			t.Fatalf("tree differs from inserting the entries")
+		}
+		if d := DiffString(r, expect, strconv.Itoa); d != "" {
+			t.Fatalf("bad:\n%s", d)
+		}
+		dups := 0
+		for _, n := range seen {
+			if n > 1 {
+				dups++
+			}
+		}
+		if len(b.Collisions()) != dups {
+			t.Fatalf("bad: %d %d", len(b.Collisions()), dups)
+		}
+	}
+}
+
+func TestEntries(t *testing.T) {
+	r := New[int]()
+	for i := 0; i < 500; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("entry/%d/%d", i%13, i)), i)
+	}
+	r, _, _ = r.Insert(nil, -1)
+
+	entries := r.Root().Entries()
+	if len(entries) != r.Len() || cap(entries) != r.Len() {
+		t.Fatalf("bad: %d %d", len(entries), cap(entries))
+	}
+	if !sort.IsSorted(entries) {
+		t.Fatalf("bad: not sorted")
+	}
+
+	// Round trip through the sorted fast path.
+	hashV := func(v int) []byte { return []byte(strconv.Itoa(v)) }
+	back := FromEntries(entries)
+	if back.Len() != r.Len() || back.Root().ContentHash(hashV) != r.Root().ContentHash(hashV) {
+		t.Fatalf("bad: round trip")
+	}
+	checkSizes(t, back.Root())
+	checkCanonical(t, back.Root())
+
+	// Sorting shuffled entries gives the same tree, and so does building
+	// from them without sorting.
+	rnd := rand.New(rand.NewSource(1))
+	shuffled := append(Entries[int]{}, entries...)
+	rnd.Shuffle(len(shuffled), shuffled.Swap)
+	unsorted := FromEntries(shuffled)
+	if unsorted.Root().ContentHash(hashV) != r.Root().ContentHash(hashV) {
+		t.Fatalf("bad: unsorted")
+	}
+	sort.Sort(shuffled)
+	sorted := FromEntries(shuffled)
+	if sorted.Root().ContentHash(hashV) != r.Root().ContentHash(hashV) {
+		t.Fatalf("bad: sorted")
+	}
+	checkCanonical(t, sorted.Root())
+
+	// The last of a repeated key wins.
+	dups := Entries[int]{{[]byte("b"), 1}, {[]byte("a"), 2}, {[]byte("b"), 3}}
+	if v, _ := FromEntries(dups).Get([]byte("b")); v != 3 {
+		t.Fatalf("bad: %d", v)
+	}
+	sort.Stable(dups)
+	if v, _ := FromEntries(dups).Get([]byte("b")); v != 3 {
+		t.Fatalf("bad: %d", v)
+	}
+
+	if FromEntries(Entries[int]{}).Len() != 0 || len(New[int]().Root().Entries()) != 0 {
+		t.Fatalf("bad")
+	}
+}
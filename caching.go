@@ -0,0 +1,74 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// CachingMatcher matches keys against the patterns in a tree like
+// MatchWithWildcards, remembering the results for the most recently used keys
+// so that repeated lookups of the same key don't walk the tree again. A tree
+// doesn't know about the versions that come after it, so the matcher is given
+// a function that returns the latest version, such as the Load method of an
+// atomic.Pointer that writers store each new tree in. Each Match checks that
+// version with SameSnapshot, and drops every cached result as soon as it's a
+// different tree, since any write may change what a key matches. That makes
+// the cache only worthwhile for trees that change much less often than
+// they're read. A CachingMatcher is not thread safe, and should only be used
+// by a single goroutine.
+type CachingMatcher[T any] struct {
+	current func() *Tree[T]
+
+	// tree is the version of the tree that the cached results are for.
+	tree  *Tree[T]
+	cache *simplelru.LRU[string, cachedMatch]
+
+	hits, misses int
+}
+
+// cachedMatch is the result of matching a key.
+type cachedMatch struct {
+	pattern []byte
+	ok      bool
+}
+
+// NewCachingMatcher returns a CachingMatcher for the latest version of a tree,
+// as returned by current, which caches the results for up to size keys. An
+// error is returned if size isn't positive.
+func NewCachingMatcher[T any](current func() *Tree[T], size int) (*CachingMatcher[T], error) {
+	cache, err := simplelru.NewLRU[string, cachedMatch](size, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CachingMatcher[T]{
+		current: current,
+		cache:   cache,
+	}, nil
+}
+
+// Match returns the most specific pattern in the latest version of the tree
+// that matches the key, and whether there was any match at all, with the same
+// meaning as MatchWithRemainder. The returned pattern must not be modified.
+func (m *CachingMatcher[T]) Match(key []byte) (pattern []byte, ok bool) {
+	if tree := m.current(); !SameSnapshot(tree, m.tree) {
+		m.cache.Purge()
+		m.tree = tree
+	}
+
+	if r, ok := m.cache.Get(string(key)); ok {
+		m.hits++
+		return r.pattern, r.ok
+	}
+	m.misses++
+	pattern, _, _, ok = m.tree.Root().MatchWithRemainder(key)
+	m.cache.Add(string(key), cachedMatch{pattern, ok})
+	return pattern, ok
+}
+
+// Stats returns the number of calls to Match that were answered from the
+// cache, and the number that had to match against the tree.
+func (m *CachingMatcher[T]) Stats() (hits, misses int) {
+	return m.hits, m.misses
+}
@@ -0,0 +1,86 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCachingMatcher(t *testing.T) {
+	var latest atomic.Pointer[Tree[int]]
+	r := New[int]()
+	for _, p := range []string{"tenant.*", "tenant.abc.*", "exact"} {
+		r, _, _ = r.Insert([]byte(p), 0)
+	}
+	latest.Store(r)
+
+	if _, err := NewCachingMatcher(latest.Load, 0); err == nil {
+		t.Fatalf("expected error")
+	}
+	m, err := NewCachingMatcher(latest.Load, 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expect := func(key, pattern string, hits, misses int) {
+		t.Helper()
+		got, ok := m.Match([]byte(key))
+		if pattern == "" {
+			if ok {
+				t.Fatalf("bad: %q matched %q", key, got)
+			}
+		} else if !ok || string(got) != pattern {
+			t.Fatalf("bad: %q: %q %v, expected %q", key, got, ok, pattern)
+		}
+		if h, m := m.Stats(); h != hits || m != misses {
+			t.Fatalf("bad: %q: %d hits %d misses, expected %d %d", key, h, m, hits, misses)
+		}
+	}
+
+	// Repeated lookups hit the cache, including ones that didn't match.
+	expect("tenant.abc.x", "tenant.abc.*", 0, 1)
+	expect("tenant.abc.x", "tenant.abc.*", 1, 1)
+	expect("nope", "", 1, 2)
+	expect("nope", "", 2, 2)
+	expect("tenant.abc.x", "tenant.abc.*", 3, 2)
+
+	// The least recently used key is evicted.
+	expect("exact", "exact", 3, 3)
+	expect("nope", "", 3, 4)
+	expect("exact", "exact", 4, 4)
+
+	// A new version of the tree drops everything that was cached.
+	r2, _, _ := r.Insert([]byte("nope"), 0)
+	latest.Store(r2)
+	expect("nope", "nope", 4, 5)
+	expect("exact", "exact", 4, 6)
+	expect("nope", "nope", 5, 6)
+
+	r3, _, _ := r2.Delete([]byte("exact"))
+	latest.Store(r3)
+	expect("exact", "", 5, 7)
+
+	// Publishing the same version again keeps the cache.
+	latest.Store(r3)
+	expect("exact", "", 6, 7)
+}
+
+func BenchmarkCachingMatcher(b *testing.B) {
+	r := New[int]()
+	for i := 0; i < 1000; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("tenant.%d.project.*", i)), i)
+	}
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("tenant.%d.project.x.member.add", i*7))
+	}
+	m, _ := NewCachingMatcher(func() *Tree[int] { return r }, len(keys))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Match(keys[i%len(keys)])
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"iter"
+	"reflect"
+	"strings"
+)
+
+// diffLeaves does a merge-join of the nodes of the two given trees in key
+// order, calling fn for each key whose leaf differs between them. The old leaf
+// is nil for keys only present in b, and the new leaf is nil for keys only
+// present in a. When both are set the leaves are different objects, but it's
+// up to the caller to decide whether their values differ. Subtrees that are
+// shared by pointer between the two trees are skipped entirely, so comparing
+// a tree against a recent snapshot of itself only visits the modified paths.
+// Returns false if fn stopped the walk early by returning false.
+func diffLeaves[T any](a, b *Node[T], fn func(key []byte, old, new *leafNode[T]) bool) bool {
+	aIter := a.rawIterator()
+	bIter := b.rawIterator()
+	for aIter.Front() != nil || bIter.Front() != nil {
+		aElem, bElem := aIter.Front(), bIter.Front()
+
+		// Once one side is exhausted everything left on the other side
+		// is either an addition or a removal.
+		if aElem == nil {
+			if bElem.isLeaf() && !fn(bElem.leaf.key, nil, bElem.leaf) {
+				return false
+			}
+			bIter.Next()
+			continue
+		}
+		if bElem == nil {
+			if aElem.isLeaf() && !fn(aElem.leaf.key, aElem.leaf, nil) {
+				return false
+			}
+			aIter.Next()
+			continue
+		}
+
+		// The raw iterators visit nodes in order of their paths, so we
+		// can step whichever one is behind.
+		cmp := strings.Compare(aIter.Path(), bIter.Path())
+		if cmp < 0 {
+			if aElem.isLeaf() && !fn(aElem.leaf.key, aElem.leaf, nil) {
+				return false
+			}
+			aIter.Next()
+			continue
+		}
+		if cmp > 0 {
+			if bElem.isLeaf() && !fn(bElem.leaf.key, nil, bElem.leaf) {
+				return false
+			}
+			bIter.Next()
+			continue
+		}
+
+		// Identical nodes at the same path have identical subtrees, so
+		// there's nothing to compare beneath them.
+		if aElem == bElem {
+			aIter.skipSubtree()
+			bIter.skipSubtree()
+			continue
+		}
+
+		if aElem.leaf != bElem.leaf {
+			var key []byte
+			if aElem.leaf != nil {
+				key = aElem.leaf.key
+			} else {
+				key = bElem.leaf.key
+			}
+			if !fn(key, aElem.leaf, bElem.leaf) {
+				return false
+			}
+		}
+		aIter.Next()
+		bIter.Next()
+	}
+	return true
+}
+
+// DiffString returns a description of the changes needed to turn tree a into
+// tree b, with one "-key value" line for each key that is removed and one
+// "+key value" line for each key that is added, in key order. A key whose
+// value changes gets a "-" line for the old value followed by a "+" line for
+// the new one. Values are rendered with fmtV, and are considered to be equal
+// if they render the same. The empty string is returned if the trees hold the
+// same contents. This is mostly intended to make test failures readable.
+func DiffString[T any](a, b *Tree[T], fmtV func(T) string) string {
+	var sb strings.Builder
+	line := func(op byte, key []byte, v string) {
+		sb.WriteByte(op)
+		sb.Write(key)
+		sb.WriteByte(' ')
+		sb.WriteString(v)
+		sb.WriteByte('\n')
+	}
+	diffLeaves(a.root, b.root, func(key []byte, old, new *leafNode[T]) bool {
+		switch {
+		case new == nil:
+			line('-', key, fmtV(old.val))
+		case old == nil:
+			line('+', key, fmtV(new.val))
+		default:
+			oldV, newV := fmtV(old.val), fmtV(new.val)
+			if oldV != newV {
+				line('-', key, oldV)
+				line('+', key, newV)
+			}
+		}
+		return true
+	})
+	return sb.String()
+}
+
+// ChangeKind says how a key changed between two trees.
+type ChangeKind int
+
+const (
+	// ChangeAdded means the key is only present in the newer tree.
+	ChangeAdded ChangeKind = iota
+
+	// ChangeDeleted means the key is only present in the older tree.
+	ChangeDeleted
+
+	// ChangeModified means the key is present in both trees with
+	// different values.
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeDeleted:
+		return "deleted"
+	case ChangeModified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// ChangeRecord describes the change to a single key. Old is the zero value for
+// an added key, and New is the zero value for a deleted one.
+type ChangeRecord[T any] struct {
+	Kind ChangeKind
+	Old  T
+	New  T
+}
+
+// Equaler is implemented by values that know how to compare themselves. The
+// operations that compare values, such as ChangesSince and Diff, use Equal
+// when T implements it, and reflect.DeepEqual otherwise. The variants that
+// take an explicit eq function, such as ChangesSinceFunc and DiffFunc, always
+// use that instead.
+type Equaler[T any] interface {
+	Equal(other T) bool
+}
+
+// valuesEqual compares two values with eq if it's given, otherwise with
+// Equaler if T implements it, and otherwise with reflect.DeepEqual.
+func valuesEqual[T any](a, b T, eq func(a, b T) bool) bool {
+	if eq != nil {
+		return eq(a, b)
+	}
+	if e, ok := any(a).(Equaler[T]); ok {
+		return e.Equal(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// ChangesSince returns an iterator over the keys whose values differ between
+// prev and t, in sorted key order, along with how each one changed. When prev
+// is an earlier snapshot that t was derived from, any subtree that wasn't
+// touched since is still shared between the two and is skipped without being
+// visited, so the cost is proportional to the number of changes. For two
+// unrelated trees nothing is shared and this falls back to walking both in
+// full. Where a key's leaf was rewritten the values are compared as described
+// for Equaler, so writing back the same value isn't reported as a change.
+func (t *Tree[T]) ChangesSince(prev *Tree[T]) iter.Seq2[[]byte, ChangeRecord[T]] {
+	return t.ChangesSinceFunc(prev, nil)
+}
+
+// ChangesSinceFunc is like ChangesSince, but compares rewritten values with
+// eq, which takes precedence over Equaler. A nil eq is the same as calling
+// ChangesSince.
+func (t *Tree[T]) ChangesSinceFunc(prev *Tree[T], eq func(a, b T) bool) iter.Seq2[[]byte, ChangeRecord[T]] {
+	return func(yield func([]byte, ChangeRecord[T]) bool) {
+		diffLeaves(prev.root, t.root, func(key []byte, old, new *leafNode[T]) bool {
+			var rec ChangeRecord[T]
+			switch {
+			case new == nil:
+				rec.Kind, rec.Old = ChangeDeleted, old.val
+			case old == nil:
+				rec.Kind, rec.New = ChangeAdded, new.val
+			default:
+				if valuesEqual(old.val, new.val, eq) {
+					return true
+				}
+				rec.Kind, rec.Old, rec.New = ChangeModified, old.val, new.val
+			}
+			return yield(key, rec)
+		})
+	}
+}
+
+// FirstDifference returns the smallest key whose entry differs between the two
+// trees, along with whether it's set in each of them, or ok false if the trees
+// hold the same entries. Values present in both are compared with eq, which
+// may be nil to compare them as described for Equaler. Like ChangesSince, this
+// skips any subtree that the two trees share, and it stops at the first
+// difference, so checking a tree against a slightly modified copy of itself
+// only visits the paths that were modified, up to the first change.
+func FirstDifference[T any](a, b *Tree[T], eq func(a, b T) bool) (key []byte, inA, inB bool, ok bool) {
+	diffLeaves(a.root, b.root, func(k []byte, old, new *leafNode[T]) bool {
+		if old != nil && new != nil && valuesEqual(old.val, new.val, eq) {
+			return true
+		}
+		key, inA, inB, ok = k, old != nil, new != nil, true
+		return false
+	})
+	return key, inA, inB, ok
+}
+
+// KV is a key and its value.
+type KV[T any] struct {
+	Key   []byte
+	Value T
+}
+
+// Diff returns the changes needed to turn tree a into tree b: the keys that
+// are only in b, the keys in both whose values differ, with their values from
+// b, and the keys that are only in a. Each list is in key order. This is
+// ChangesSince in a form that can be sent elsewhere and given to ApplyPatch
+// on a copy of a.
+func Diff[T any](a, b *Tree[T]) (added, changed []KV[T], removed [][]byte) {
+	return DiffFunc(a, b, nil)
+}
+
+// DiffFunc is like Diff, but compares values with eq, which takes precedence
+// over Equaler. A nil eq is the same as calling Diff.
+func DiffFunc[T any](a, b *Tree[T], eq func(a, b T) bool) (added, changed []KV[T], removed [][]byte) {
+	for k, rec := range b.ChangesSinceFunc(a, eq) {
+		switch rec.Kind {
+		case ChangeAdded:
+			added = append(added, KV[T]{k, rec.New})
+		case ChangeModified:
+			changed = append(changed, KV[T]{k, rec.New})
+		case ChangeDeleted:
+			removed = append(removed, k)
+		}
+	}
+	return added, changed, removed
+}
+
+// ApplyPatch applies the given changes to the transaction, such as those
+// returned by Diff. The removed keys are deleted first, skipping any that
+// aren't present, and then the added and changed keys are set, so an added key
+// that's already present is just changed. With TrackMutate enabled, the
+// commit fires the watches for the affected keys like any other writes.
+func (t *Txn[T]) ApplyPatch(added, changed []KV[T], removed [][]byte) {
+	for _, k := range removed {
+		t.Delete(k)
+	}
+	for _, kv := range added {
+		t.Insert(kv.Key, kv.Value)
+	}
+	for _, kv := range changed {
+		t.Insert(kv.Key, kv.Value)
+	}
+}
+
+// ApplyPatch returns a new tree with the given changes applied in a single
+// transaction, as described for Txn.ApplyPatch. Like Insert and Delete on a
+// tree, this doesn't track mutations; to fire watches, use Txn.ApplyPatch on
+// a transaction with TrackMutate enabled. The tree it's called on is
+// unchanged.
+func (t *Tree[T]) ApplyPatch(added, changed []KV[T], removed [][]byte) *Tree[T] {
+	txn := t.TxnWithCapacity(len(added) + len(changed) + len(removed))
+	txn.ApplyPatch(added, changed, removed)
+	return txn.Commit()
+}
@@ -0,0 +1,406 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffString(t *testing.T) {
+	a := New[int]()
+	for i, k := range []string{"bar", "foo", "foobar", "zip"} {
+		a, _, _ = a.Insert([]byte(k), i)
+	}
+
+	txn := a.Txn()
+	txn.Delete([]byte("bar"))
+	txn.Insert([]byte("foobar"), 42)
+	txn.Insert([]byte("foobaz"), 7)
+	txn.Insert([]byte("zip"), 3) // same value, new leaf
+	b := txn.Commit()
+
+	got := DiffString(a, b, strconv.Itoa)
+	expect := strings.Join([]string{
+		"-bar 0",
+		"-foobar 2",
+		"+foobar 42",
+		"+foobaz 7",
+		"",
+	}, "\n")
+	if got != expect {
+		t.Fatalf("mis-match:\n%s\nwant:\n%s", got, expect)
+	}
+
+	if got := DiffString(a, a, strconv.Itoa); got != "" {
+		t.Fatalf("bad: %q", got)
+	}
+	if got := DiffString(New[int](), New[int](), strconv.Itoa); got != "" {
+		t.Fatalf("bad: %q", got)
+	}
+}
+
+func TestDiffLeaves_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() string {
+		const letters = "abc."
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return string(b)
+	}
+
+	for round := 0; round < 200; round++ {
+		a := New[int]()
+		ma := make(map[string]int)
+		for i := 0; i < 30; i++ {
+			k := randKey()
+			a, _, _ = a.Insert([]byte(k), i)
+			ma[k] = i
+		}
+
+		// Derive b from a so that most of the structure is shared.
+		txn := a.Txn()
+		mb := make(map[string]int)
+		for k, v := range ma {
+			mb[k] = v
+		}
+		for i := 0; i < 5; i++ {
+			k := randKey()
+			if rnd.Intn(2) == 0 {
+				txn.Delete([]byte(k))
+				delete(mb, k)
+			} else {
+				txn.Insert([]byte(k), 100+i)
+				mb[k] = 100 + i
+			}
+		}
+		b := txn.Commit()
+
+		var expect []string
+		for k, v := range ma {
+			if bv, ok := mb[k]; !ok {
+				expect = append(expect, fmt.Sprintf("-%s %d", k, v))
+			} else if bv != v {
+				expect = append(expect, fmt.Sprintf("~%s %d %d", k, v, bv))
+			}
+		}
+		for k, v := range mb {
+			if _, ok := ma[k]; !ok {
+				expect = append(expect, fmt.Sprintf("+%s %d", k, v))
+			}
+		}
+		sort.Slice(expect, func(i, j int) bool { return expect[i][1:] < expect[j][1:] })
+
+		var got []string
+		diffLeaves(a.root, b.root, func(key []byte, old, new *leafNode[int]) bool {
+			switch {
+			case new == nil:
+				got = append(got, fmt.Sprintf("-%s %d", key, old.val))
+			case old == nil:
+				got = append(got, fmt.Sprintf("+%s %d", key, new.val))
+			case old.val != new.val:
+				got = append(got, fmt.Sprintf("~%s %d %d", key, old.val, new.val))
+			}
+			return true
+		})
+		if strings.Join(got, "|") != strings.Join(expect, "|") {
+			t.Fatalf("mis-match:\n got=%v\nwant=%v", got, expect)
+		}
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	base := New[int]()
+	for i, k := range []string{"bar", "foo", "foobar", "zip"} {
+		base, _, _ = base.Insert([]byte(k), i)
+	}
+	txn := base.Txn()
+	txn.Delete([]byte("bar"))
+	txn.Insert([]byte("foobar"), 42)
+	txn.Insert([]byte("foobaz"), 7)
+	txn.Insert([]byte("zip"), 3) // same value, not a change
+	next := txn.Commit()
+
+	collect := func(seq func(func([]byte, ChangeRecord[int]) bool)) []string {
+		var out []string
+		for k, rec := range seq {
+			out = append(out, fmt.Sprintf("%s:%s:%d:%d", k, rec.Kind, rec.Old, rec.New))
+		}
+		return out
+	}
+	expect := []string{
+		"bar:deleted:0:0",
+		"foobar:modified:2:42",
+		"foobaz:added:0:7",
+	}
+
+	// Ancestor snapshot, where most of the tree is shared.
+	if got := collect(next.ChangesSince(base)); strings.Join(got, "|") != strings.Join(expect, "|") {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := collect(next.ChangesSince(next)); len(got) != 0 {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Unrelated trees with the same contents as the snapshots.
+	rebuild := func(src *Tree[int]) *Tree[int] {
+		out := New[int]()
+		src.Root().Walk(func(k []byte, v int) bool {
+			out, _, _ = out.Insert([]byte(string(k)), v)
+			return false
+		})
+		return out
+	}
+	if got := collect(rebuild(next).ChangesSince(rebuild(base))); strings.Join(got, "|") != strings.Join(expect, "|") {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := collect(rebuild(next).ChangesSince(next)); len(got) != 0 {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Breaking out early stops the walk.
+	var seen []string
+	for k := range next.ChangesSince(base) {
+		seen = append(seen, string(k))
+		if len(seen) == 2 {
+			break
+		}
+	}
+	if strings.Join(seen, ",") != "bar,foobar" {
+		t.Fatalf("bad: %v", seen)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	a := New[int]()
+	for i, k := range []string{"a", "b", "c", "d"} {
+		a, _, _ = a.Insert([]byte(k), i)
+	}
+	b := a.Txn()
+	b.Delete([]byte("a"))
+	b.Insert([]byte("c"), 20)
+	b.Insert([]byte("e"), 4)
+	bt := b.Commit()
+
+	added, changed, removed := Diff(a, bt)
+	if fmt.Sprint(added, changed, removed) != "[{[101] 4}] [{[99] 20}] [[97]]" {
+		t.Fatalf("bad: %v %v %v", added, changed, removed)
+	}
+
+	// Watches fire for the keys the patch touches, and not the others.
+	aCh, _, _ := a.Root().GetWatch([]byte("a"))
+	cCh, _, _ := a.Root().GetWatch([]byte("c"))
+	dCh, _, _ := a.Root().GetWatch([]byte("d"))
+	txn := a.Txn()
+	txn.TrackMutate(true)
+	txn.ApplyPatch(added, changed, removed)
+	p := txn.Commit()
+	if d := DiffString(p, bt, strconv.Itoa); d != "" {
+		t.Fatalf("bad:\n%s", d)
+	}
+	for _, ch := range []<-chan struct{}{aCh, cCh} {
+		select {
+		case <-ch:
+		default:
+			t.Fatalf("expected a notification")
+		}
+	}
+	select {
+	case <-dCh:
+		t.Fatalf("unexpected notification")
+	default:
+	}
+
+	// The tree version gives the same result, without notifying.
+	eCh, _, _ := p.Root().GetWatch([]byte("e"))
+	if d := DiffString(p.ApplyPatch(Diff(p, a)), a, strconv.Itoa); d != "" {
+		t.Fatalf("bad:\n%s", d)
+	}
+	select {
+	case <-eCh:
+		t.Fatalf("unexpected notification")
+	default:
+	}
+
+	// Missing removed keys are skipped, and added keys that exist are
+	// changed.
+	p = a.ApplyPatch([]KV[int]{{[]byte("a"), 10}}, nil, [][]byte{[]byte("nope")})
+	if p.Len() != 4 {
+		t.Fatalf("bad: %d", p.Len())
+	}
+	if v, _ := p.Get([]byte("a")); v != 10 {
+		t.Fatalf("bad: %d", v)
+	}
+
+	// An empty patch gives the same contents.
+	if d := DiffString(a.ApplyPatch(nil, nil, nil), a, strconv.Itoa); d != "" {
+		t.Fatalf("bad:\n%s", d)
+	}
+}
+
+func TestApplyPatch_RoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "abc."
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+	randTree := func(from *Tree[int], n int) *Tree[int] {
+		txn := from.Txn()
+		for i := 0; i < n; i++ {
+			if rnd.Intn(3) == 0 {
+				txn.Delete(randKey())
+			} else {
+				txn.Insert(randKey(), rnd.Intn(10))
+			}
+		}
+		return txn.Commit()
+	}
+
+	for round := 0; round < 200; round++ {
+		a := randTree(New[int](), 30)
+
+		// Try both a tree derived from a and an unrelated one.
+		for _, b := range []*Tree[int]{randTree(a, 5), randTree(New[int](), 30)} {
+			p := a.ApplyPatch(Diff(a, b))
+			if d := DiffString(p, b, strconv.Itoa); d != "" {
+				t.Fatalf("bad:\n%s", d)
+			}
+			if p.Len() != b.Len() {
+				t.Fatalf("bad: %d %d", p.Len(), b.Len())
+			}
+			checkSizes(t, p.Root())
+		}
+	}
+}
+
+// versioned is only equal by version, ignoring its note.
+type versioned struct {
+	version int
+	note    string
+}
+
+func (v versioned) Equal(other versioned) bool {
+	return v.version == other.version
+}
+
+func TestDiff_Equaler(t *testing.T) {
+	a := New[versioned]()
+	a, _, _ = a.Insert([]byte("x"), versioned{1, "first"})
+	a, _, _ = a.Insert([]byte("y"), versioned{2, "first"})
+	a, _, _ = a.Insert([]byte("z"), versioned{3, "first"})
+
+	b, _, _ := a.Insert([]byte("x"), versioned{1, "reworded"})
+	b, _, _ = b.Insert([]byte("y"), versioned{5, "first"})
+
+	keys := func(kvs []KV[versioned]) string {
+		var out []string
+		for _, kv := range kvs {
+			out = append(out, string(kv.Key))
+		}
+		return strings.Join(out, ",")
+	}
+
+	// Equal is used without asking, so the reworded note isn't a change.
+	added, changed, removed := Diff(a, b)
+	if len(added) != 0 || len(removed) != 0 || keys(changed) != "y" {
+		t.Fatalf("bad: %v %v %v", added, changed, removed)
+	}
+	n := 0
+	for k := range b.ChangesSince(a) {
+		if string(k) != "y" {
+			t.Fatalf("bad: %q", k)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// An explicit eq wins over Equal.
+	byNote := func(a, b versioned) bool { return a.note == b.note }
+	_, changed, _ = DiffFunc(a, b, byNote)
+	if keys(changed) != "x" {
+		t.Fatalf("bad: %v", changed)
+	}
+	never := func(a, b versioned) bool { return false }
+	_, changed, _ = DiffFunc(a, b, never)
+	if keys(changed) != "x,y" {
+		t.Fatalf("bad: %v", changed)
+	}
+
+	// A nil eq is the same as Diff.
+	_, changed, _ = DiffFunc(a, b, nil)
+	if keys(changed) != "y" {
+		t.Fatalf("bad: %v", changed)
+	}
+}
+
+func TestFirstDifference(t *testing.T) {
+	txn := New[int]().Txn()
+	for i := 0; i < 1000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%04d", i)), i)
+	}
+	a := txn.Commit()
+
+	compared := 0
+	eq := func(x, y int) bool {
+		compared++
+		return x == y
+	}
+
+	if _, _, _, ok := FirstDifference(a, a, eq); ok || compared != 0 {
+		t.Fatalf("bad: %v %d", ok, compared)
+	}
+
+	// A change to a late key is found without comparing any of the earlier
+	// entries, which are still shared.
+	b, _, _ := a.Insert([]byte("key/0990"), -1)
+	b, _, _ = b.Insert([]byte("key/0995"), -1)
+	key, inA, inB, ok := FirstDifference(a, b, eq)
+	if !ok || string(key) != "key/0990" || !inA || !inB {
+		t.Fatalf("bad: %q %v %v %v", key, inA, inB, ok)
+	}
+	if compared != 1 {
+		t.Fatalf("bad: compared %d values", compared)
+	}
+
+	// Rewriting a value with the same one isn't a difference.
+	c, _, _ := a.Insert([]byte("key/0500"), 500)
+	if _, _, _, ok := FirstDifference(a, c, nil); ok {
+		t.Fatalf("bad")
+	}
+
+	// Keys only in one tree.
+	d, _, _ := a.Insert([]byte("key/0500x"), 0)
+	d, _, _ = d.Delete([]byte("key/0700"))
+	if key, inA, inB, ok := FirstDifference(a, d, nil); !ok || string(key) != "key/0500x" || inA || !inB {
+		t.Fatalf("bad: %q %v %v %v", key, inA, inB, ok)
+	}
+	e, _, _ := a.Delete([]byte("key/0700"))
+	if key, inA, inB, ok := FirstDifference(a, e, nil); !ok || string(key) != "key/0700" || !inA || inB {
+		t.Fatalf("bad: %q %v %v %v", key, inA, inB, ok)
+	}
+
+	// Separately built trees with the same entries are equal, but have to
+	// be compared in full.
+	compared = 0
+	same, _ := FromSlices(keysOf(a), a.Root().ValuesPrefix(nil))
+	if _, _, _, ok := FirstDifference(a, same, eq); ok || compared != a.Len() {
+		t.Fatalf("bad: %v %d", ok, compared)
+	}
+
+	if _, _, _, ok := FirstDifference(New[int](), New[int](), nil); ok {
+		t.Fatalf("bad")
+	}
+}
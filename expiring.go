@@ -0,0 +1,145 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"container/heap"
+	"time"
+)
+
+// ExpiringTree wraps a radix tree where each entry carries an expiration
+// time. Expired entries are treated as absent by all reads as soon as they
+// expire, and are physically removed from the underlying tree by calling
+// SweepExpired. The tree remains the source of truth for which entries exist
+// and when they expire; a min-heap of expirations is kept alongside it only so
+// that sweeping doesn't need to scan the whole tree.
+//
+// Unlike Tree, an ExpiringTree is updated in place and is not thread safe. It
+// should only be used by a single goroutine.
+type ExpiringTree[T any] struct {
+	tree *Tree[expiringValue[T]]
+	heap expiryHeap
+
+	// now is used to tell the time, and can be replaced by tests.
+	now func() time.Time
+}
+
+// expiringValue is the value stored in the underlying tree for each entry.
+type expiringValue[T any] struct {
+	val     T
+	expires time.Time
+}
+
+// NewExpiring returns an empty ExpiringTree
+func NewExpiring[T any]() *ExpiringTree[T] {
+	return &ExpiringTree[T]{
+		tree: New[expiringValue[T]](),
+		now:  time.Now,
+	}
+}
+
+// Len is used to return the number of entries held in the tree. This includes
+// entries that have expired but haven't been removed by SweepExpired yet.
+func (e *ExpiringTree[T]) Len() int {
+	return e.tree.Len()
+}
+
+// InsertWithTTL is used to add or update a given key, which will expire after
+// the given ttl. The return provides the previous value and a bool indicating
+// if any was set and hadn't yet expired.
+func (e *ExpiringTree[T]) InsertWithTTL(k []byte, v T, ttl time.Duration) (T, bool) {
+	now := e.now()
+	expires := now.Add(ttl)
+
+	var old expiringValue[T]
+	var ok bool
+	e.tree, old, ok = e.tree.Insert(k, expiringValue[T]{val: v, expires: expires})
+	heap.Push(&e.heap, expiryEntry{key: k, expires: expires})
+
+	if !ok || !now.Before(old.expires) {
+		var zero T
+		return zero, false
+	}
+	return old.val, true
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found. Entries that have expired are not found, even if they haven't been
+// swept yet.
+func (e *ExpiringTree[T]) Get(k []byte) (T, bool) {
+	v, ok := e.tree.Get(k)
+	if !ok || !e.now().Before(v.expires) {
+		var zero T
+		return zero, false
+	}
+	return v.val, true
+}
+
+// Delete is used to delete a given key. Returns the old value if any, and a
+// bool indicating if the key was set and hadn't yet expired.
+func (e *ExpiringTree[T]) Delete(k []byte) (T, bool) {
+	var old expiringValue[T]
+	var ok bool
+	e.tree, old, ok = e.tree.Delete(k)
+	if !ok || !e.now().Before(old.expires) {
+		var zero T
+		return zero, false
+	}
+	return old.val, true
+}
+
+// SweepExpired removes all the entries that have expired as of the given time
+// from the underlying tree, in a single transaction. Returns the number of
+// entries that were removed.
+func (e *ExpiringTree[T]) SweepExpired(now time.Time) int {
+	txn := e.tree.Txn()
+	removed := 0
+	for len(e.heap) > 0 && !now.Before(e.heap[0].expires) {
+		entry := heap.Pop(&e.heap).(expiryEntry)
+
+		// The key may have since been deleted or re-inserted with a later
+		// expiration, so check with the tree before removing it.
+		if v, ok := txn.Get(entry.key); ok && !now.Before(v.expires) {
+			txn.Delete(entry.key)
+			removed++
+		}
+	}
+	e.tree = txn.Commit()
+	return removed
+}
+
+// expiryEntry records when a key was set to expire. The heap may hold stale
+// entries for keys that have been deleted or updated.
+type expiryEntry struct {
+	key     []byte
+	expires time.Time
+}
+
+// expiryHeap is a min-heap of expiry entries implementing heap.Interface.
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].expires.Before(h[j].expires)
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *expiryHeap) Push(x any) {
+	*h = append(*h, x.(expiryEntry))
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = expiryEntry{}
+	*h = old[:n-1]
+	return x
+}
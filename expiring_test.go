@@ -0,0 +1,73 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiringTree(t *testing.T) {
+	now := time.Unix(1000, 0)
+	e := NewExpiring[int]()
+	e.now = func() time.Time { return now }
+
+	e.InsertWithTTL([]byte("foo"), 1, time.Second)
+	e.InsertWithTTL([]byte("foobar"), 2, time.Minute)
+	e.InsertWithTTL([]byte("zip"), 3, time.Second)
+	if e.Len() != 3 {
+		t.Fatalf("bad len: %d", e.Len())
+	}
+	if v, ok := e.Get([]byte("foo")); !ok || v != 1 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+
+	// Refresh zip so its first expiration is stale.
+	if old, ok := e.InsertWithTTL([]byte("zip"), 4, time.Hour); !ok || old != 3 {
+		t.Fatalf("bad: %v %v", old, ok)
+	}
+
+	// Once expired the entry can't be seen, even before a sweep.
+	now = now.Add(2 * time.Second)
+	if _, ok := e.Get([]byte("foo")); ok {
+		t.Fatalf("expired key was found")
+	}
+	if v, ok := e.Get([]byte("foobar")); !ok || v != 2 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if v, ok := e.Get([]byte("zip")); !ok || v != 4 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if e.Len() != 3 {
+		t.Fatalf("bad len: %d", e.Len())
+	}
+	if _, ok := e.tree.Get([]byte("foo")); !ok {
+		t.Fatalf("expired key was removed before sweep")
+	}
+
+	// Sweeping reclaims only the expired entry.
+	if n := e.SweepExpired(now); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	if e.Len() != 2 {
+		t.Fatalf("bad len: %d", e.Len())
+	}
+	if _, ok := e.tree.Get([]byte("foo")); ok {
+		t.Fatalf("expired key wasn't removed")
+	}
+	if n := e.SweepExpired(now); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// A deleted key's heap entry is skipped when it comes due.
+	if v, ok := e.Delete([]byte("foobar")); !ok || v != 2 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if n := e.SweepExpired(now.Add(2 * time.Hour)); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	if e.Len() != 0 || len(e.heap) != 0 {
+		t.Fatalf("bad len: %d %d", e.Len(), len(e.heap))
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// MatchGlob checks if a key matches any glob pattern in the tree, where a '*' in the
+// pattern matches any sequence of bytes, including the empty sequence and any dots.
+// Unlike MatchWithWildcards, a '*' isn't tied to segment boundaries, and may appear
+// anywhere in a pattern any number of times, so "a*d.txt" matches "abc.def.d.txt". The
+// two kinds of pattern are kept to separate methods, so the same stored pattern is read
+// with segment semantics by MatchWithWildcards and with glob semantics by MatchGlob.
+// Keys that were inserted with InsertLiteral only match an identical key.
+//
+// Rather than backtracking over each pattern in turn, this walks the tree once, keeping
+// the set of key positions that the path so far could have matched up to. A '*' extends
+// the set to every position from its smallest onwards, and any other byte advances each
+// position that matches it, so a subtree is abandoned as soon as the set is empty. This
+// explores every way the stars could consume the key, but costs at most the length of
+// the key per pattern byte visited.
+func (n *Node[T]) MatchGlob(key []byte) bool {
+	// Check for an exact match first, which also covers literal keys
+	if _, ok := n.Get(key); ok {
+		return true
+	}
+	return matchGlob(n, key, []int{0})
+}
+
+// matchGlob does the work for MatchGlob, where positions holds the sorted offsets
+// into key that the path down to n could have matched up to, before n's prefix.
+func matchGlob[T any](n *Node[T], key []byte, positions []int) bool {
+	for _, c := range n.prefix {
+		if c == '*' {
+			// The star can consume any number of bytes from the
+			// earliest position we could have reached.
+			if positions[0] == len(key) && len(positions) == 1 {
+				continue
+			}
+			next := make([]int, 0, len(key)-positions[0]+1)
+			for i := positions[0]; i <= len(key); i++ {
+				next = append(next, i)
+			}
+			positions = next
+			continue
+		}
+
+		next := make([]int, 0, len(positions))
+		for _, p := range positions {
+			if p < len(key) && key[p] == c {
+				next = append(next, p+1)
+			}
+		}
+		if len(next) == 0 {
+			return false
+		}
+		positions = next
+	}
+
+	// A pattern ending here matches if it could have consumed the whole key,
+	// which would be the last position since they're sorted.
+	if isPattern(n.leaf) && positions[len(positions)-1] == len(key) {
+		return true
+	}
+
+	for _, e := range n.edges {
+		if matchGlob(e.node, key, positions) {
+			return true
+		}
+	}
+	return false
+}
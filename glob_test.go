@@ -0,0 +1,111 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"math/rand"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	type exp struct {
+		pattern string
+		key     string
+		out     bool
+	}
+	cases := []exp{
+		{"a*d.txt", "abc.def.d.txt", true},
+		{"a*d.txt", "ad.txt", true},
+		{"a*d.txt", "abc.def.d.txx", false},
+		{"*", "", true},
+		{"*", "anything.at.all", true},
+		{"a*", "a", true},
+		{"a*", "abc", true},
+		{"a*", "ba", false},
+		{"*a", "bba", true},
+		{"*a", "ab", false},
+		{"a**b", "ab", true},
+		{"a**b", "axxb", true},
+		{"a***", "a", true},
+		{"a*b*c", "abxbxc", true},
+		{"a*b*c", "abxbx", false},
+		{"a*b*c", "acb", false},
+		{"*a*a*a*b", "aaaaaaaaaaaaaaaaaaaaaaaaaaaa", false},
+		{"*a*a*a*b", "aaaaaaaaaaaaaaaaaaaaaaaaaaab", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.b.example.com", true},
+		{"exact", "exact", true},
+		{"exact", "exac", false},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, test := range cases {
+		r := New[bool]()
+		r, _, _ = r.Insert([]byte(test.pattern), true)
+		if got := r.Root().MatchGlob([]byte(test.key)); got != test.out {
+			t.Fatalf("mis-match: %q against %q got %v want %v", test.key, test.pattern, got, test.out)
+		}
+	}
+
+	// Several patterns sharing the tree.
+	r := New[bool]()
+	for _, p := range []string{"img/*.png", "img/*/*.jpg", "doc*", "x*y*z"} {
+		r, _, _ = r.Insert([]byte(p), true)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit*"), true)
+	cases = []exp{
+		{"", "img/a.png", true},
+		{"", "img/a/b.png", true},
+		{"", "img/a/b.jpg", true},
+		{"", "img/b.jpg", false},
+		{"", "docs/readme", true},
+		{"", "xyz", true},
+		{"", "x.y.z", true},
+		{"", "xzy", false},
+		{"", "lit*", true},
+		{"", "literal", false},
+	}
+	for _, test := range cases {
+		if got := r.Root().MatchGlob([]byte(test.key)); got != test.out {
+			t.Fatalf("mis-match: %q got %v want %v", test.key, got, test.out)
+		}
+	}
+}
+
+func TestMatchGlob_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randString := func(letters string) string {
+		b := make([]byte, rnd.Intn(7))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return string(b)
+	}
+
+	// path.Match treats '*' specially only within a path element, so use
+	// an alphabet without '/' to compare with it directly.
+	for round := 0; round < 500; round++ {
+		r := New[bool]()
+		var patterns []string
+		for i := 0; i < 5; i++ {
+			p := randString("ab.*")
+			patterns = append(patterns, p)
+			r, _, _ = r.Insert([]byte(p), true)
+		}
+		for i := 0; i < 20; i++ {
+			key := randString("ab.")
+			want := false
+			for _, p := range patterns {
+				if ok, _ := path.Match(p, key); ok {
+					want = true
+				}
+			}
+			if got := r.Root().MatchGlob([]byte(key)); got != want {
+				t.Fatalf("mis-match: %q against %s got %v want %v", key, strings.Join(patterns, ","), got, want)
+			}
+		}
+	}
+}
@@ -1,6 +1,6 @@
 module go.izuma.io/go-immutable-radix/v2
 
-go 1.18
+go 1.23
 
 require (
 	github.com/hashicorp/go-uuid v1.0.3
@@ -0,0 +1,51 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// ContentHash returns a SHA-256 over all of the key/value pairs under this
+// node, in sorted key order, using hashV to turn each value into bytes. The
+// hash depends only on the contents and not on how the tree was built, so two
+// trees holding the same entries hash equal regardless of their insertion
+// history. Each key and value is length-prefixed so that different contents
+// can't run together into the same input.
+func (n *Node[T]) ContentHash(hashV func(T) []byte) [32]byte {
+	return contentHash(n, hashV)
+}
+
+// PrefixHash is like ContentHash, but only covers the entries whose keys start
+// with the given prefix. Only the subtree under the prefix is visited, so
+// changes to keys outside the prefix never affect the hash. The full keys are
+// hashed, so equal contents under different prefixes hash differently. If no
+// keys start with the prefix, this is the hash of no entries, which is the
+// same as the ContentHash of an empty tree.
+func (n *Node[T]) PrefixHash(prefix []byte, hashV func(T) []byte) [32]byte {
+	return contentHash(n.prefixNode(prefix), hashV)
+}
+
+// contentHash does the work for ContentHash, treating a nil node as empty.
+func contentHash[T any](n *Node[T], hashV func(T) []byte) [32]byte {
+	h := sha256.New()
+	var lenBuf [binary.MaxVarintLen64]byte
+	write := func(b []byte) {
+		l := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+		h.Write(lenBuf[:l])
+		h.Write(b)
+	}
+	if n != nil {
+		n.Walk(func(k []byte, v T) bool {
+			write(k)
+			write(hashV(v))
+			return false
+		})
+	}
+
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
@@ -0,0 +1,121 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	hashV := func(v int) []byte { return []byte(strconv.Itoa(v)) }
+	keys := []string{"", "foo", "foobar", "foobaz", "zip", "zipper"}
+
+	a := New[int]()
+	for i, k := range keys {
+		a, _, _ = a.Insert([]byte(k), i)
+	}
+	ha := a.Root().ContentHash(hashV)
+
+	// Insertion order doesn't matter.
+	rnd := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		b := New[int]()
+		for _, i := range rnd.Perm(len(keys)) {
+			b, _, _ = b.Insert([]byte(keys[i]), i)
+		}
+		if hb := b.Root().ContentHash(hashV); hb != ha {
+			t.Fatalf("bad: %x %x", hb, ha)
+		}
+	}
+
+	// Insert then delete round-trips to the same hash.
+	b, _, _ := a.Insert([]byte("foob"), 99)
+	if b.Root().ContentHash(hashV) == ha {
+		t.Fatalf("expected a different hash")
+	}
+	b, _, _ = b.Delete([]byte("foob"))
+	if b.Root().ContentHash(hashV) != ha {
+		t.Fatalf("expected the original hash")
+	}
+
+	// Changing a value changes the hash.
+	c, _, _ := a.Insert([]byte("zip"), 100)
+	if c.Root().ContentHash(hashV) == ha {
+		t.Fatalf("expected a different hash")
+	}
+
+	// Keys and values can't run into each other.
+	d := New[int]()
+	d, _, _ = d.Insert([]byte("a1"), 2)
+	e := New[int]()
+	e, _, _ = e.Insert([]byte("a"), 12)
+	if d.Root().ContentHash(hashV) == e.Root().ContentHash(hashV) {
+		t.Fatalf("expected different hashes")
+	}
+
+	// Empty trees agree.
+	if New[int]().Root().ContentHash(hashV) != New[int]().Root().ContentHash(hashV) {
+		t.Fatalf("expected equal hashes")
+	}
+}
+
+func TestPrefixHash(t *testing.T) {
+	hashV := func(v int) []byte { return []byte(strconv.Itoa(v)) }
+	r := New[int]()
+	for i, k := range []string{"ns1.a", "ns1.b", "ns1.b.c", "ns2.a", "ns10.a", "other"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	h := r.Root().PrefixHash([]byte("ns1."), hashV)
+
+	// It only covers the entries under the prefix.
+	sub := New[int]()
+	r.Root().WalkPrefix([]byte("ns1."), func(k []byte, v int) bool {
+		sub, _, _ = sub.Insert(k, v)
+		return false
+	})
+	if sub.Root().ContentHash(hashV) != h {
+		t.Fatalf("expected the hash of the entries under the prefix")
+	}
+
+	// Changes outside the prefix don't affect it, including under a prefix
+	// that shares bytes with it.
+	for _, k := range []string{"ns2.a", "ns10.b", "ns1", "other", "p"} {
+		r2, _, _ := r.Insert([]byte(k), 99)
+		if r2.Root().PrefixHash([]byte("ns1."), hashV) != h {
+			t.Fatalf("bad: %q changed the hash", k)
+		}
+	}
+
+	// Changes under it do.
+	for _, k := range []string{"ns1.a", "ns1.", "ns1.b.c.d"} {
+		r2, _, _ := r.Insert([]byte(k), 99)
+		if r2.Root().PrefixHash([]byte("ns1."), hashV) == h {
+			t.Fatalf("bad: %q didn't change the hash", k)
+		}
+	}
+	r2, _, _ := r.Delete([]byte("ns1.b"))
+	if r2.Root().PrefixHash([]byte("ns1."), hashV) == h {
+		t.Fatalf("expected a different hash")
+	}
+
+	// A prefix with nothing under it hashes the same as an empty tree,
+	// whether or not it ends partway through a node.
+	empty := New[int]().Root().ContentHash(hashV)
+	for _, p := range []string{"nope", "ns1.z", "ns3", "othe.r"} {
+		if r.Root().PrefixHash([]byte(p), hashV) != empty {
+			t.Fatalf("bad: %q", p)
+		}
+	}
+
+	// The empty prefix covers the whole tree, and a prefix ending partway
+	// through a node includes all of the node.
+	if r.Root().PrefixHash(nil, hashV) != r.Root().ContentHash(hashV) {
+		t.Fatalf("expected the hash of the whole tree")
+	}
+	if r.Root().PrefixHash([]byte("oth"), hashV) == empty {
+		t.Fatalf("expected a non-empty hash")
+	}
+}
@@ -5,6 +5,7 @@ package iradix
 
 import (
 	"bytes"
+	"errors"
 	"strings"
 
 	"github.com/hashicorp/golang-lru/v2/simplelru"
@@ -21,6 +22,10 @@ const (
 	defaultModifiedCache = 8192
 )
 
+// ErrTxnCommitted is the value a Txn panics with when it's used after it has
+// been committed.
+var ErrTxnCommitted = errors.New("transaction has already been committed")
+
 // Tree implements an immutable radix tree. This can be treated as a
 // Dictionary abstract data type. The main advantage over a standard
 // hash map is prefix-based lookups and ordered iteration. The immutability
@@ -41,6 +46,58 @@ func New[T any]() *Tree[T] {
 	return t
 }
 
+// Clear returns an empty tree. The tree it's called on is unchanged, so this is
+// the same as New, other than reading better where a tree is being reset. It
+// doesn't close any watch channels; use Txn.DeleteAll to clear a tree and
+// notify its watchers.
+func (t *Tree[T]) Clear() *Tree[T] {
+	return New[T]()
+}
+
+// SameSnapshot returns true if the two trees have the same root node, which
+// means they hold exactly the same contents because one is an unmodified copy
+// of the other, either the same tree or the result of a transaction that made
+// no changes. This is an O(1) check that's useful before diffing two trees. It
+// can return false for trees that hold the same entries but were built
+// separately. Nil trees are only the same as each other.
+func SameSnapshot[T any](a, b *Tree[T]) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.root == b.root
+}
+
+// SharedNodeCount returns the number of nodes that the two trees share by
+// identity, which is mostly useful in tests, to check that a small change to
+// a tree left most of it shared with the original. Since nodes are immutable,
+// a shared node's whole subtree is shared too. Trees that were built
+// separately share nothing, not even an empty root. This visits every node of
+// both trees.
+func SharedNodeCount[T any](a, b *Tree[T]) int {
+	seen := make(map[*Node[T]]struct{})
+	var mark func(n *Node[T])
+	mark = func(n *Node[T]) {
+		seen[n] = struct{}{}
+		for _, e := range n.edges {
+			mark(e.node)
+		}
+	}
+	mark(a.root)
+
+	var count func(n *Node[T]) int
+	count = func(n *Node[T]) int {
+		c := 0
+		if _, ok := seen[n]; ok {
+			c++
+		}
+		for _, e := range n.edges {
+			c += count(e.node)
+		}
+		return c
+	}
+	return count(b.root)
+}
+
 // Len is used to return the number of elements in the tree
 func (t *Tree[T]) Len() int {
 	return t.size
@@ -49,6 +106,13 @@ func (t *Tree[T]) Len() int {
 // Txn is a transaction on the tree. This transaction is applied
 // atomically and returns a new tree when committed. A transaction
 // is not thread safe, and should only be used by a single goroutine.
+//
+// A transaction is single use: once Commit, CommitOnly or CommitWithUndo has
+// been called, any further call to read, write, clone, snapshot or commit it
+// panics with ErrTxnCommitted. Only Notify, Counts and Root may still be
+// called, so that notifications can be sent after CommitOnly and the outcome
+// inspected.
+// To make more changes, start a new transaction from the committed tree.
 type Txn[T any] struct {
 	// root is the modified root for the transaction.
 	root *Node[T]
@@ -77,6 +141,26 @@ type Txn[T any] struct {
 	trackChannels map[chan struct{}]struct{}
 	trackOverflow bool
 	trackMutate   bool
+
+	// capacity is the expected number of writes given to TxnWithCapacity,
+	// used to size the writable node cache and the tracking map.
+	capacity int
+
+	// copies counts the nodes that writeNode has had to copy during this
+	// transaction, and reuses the times it found a node it had already
+	// copied, for reporting via AllocStats.
+	copies int
+	reuses int
+
+	// added, replaced and deleted count the outcomes of the mutations made
+	// during this transaction, for reporting via Counts.
+	added    int
+	replaced int
+	deleted  int
+
+	// committed is set once the transaction has been committed, after which
+	// it may no longer be used.
+	committed bool
 }
 
 // Txn starts a new transaction that can be used to mutate the tree
@@ -89,20 +173,45 @@ func (t *Tree[T]) Txn() *Txn[T] {
 	return txn
 }
 
+// TxnWithCapacity is like Txn, but sizes the transaction's internal state for
+// a batch of about n writes. Normally the writable node cache is bounded, so
+// in a very large batch nodes near the root are evicted and then copied again
+// each time they're next written; with a capacity, the cache is allowed to
+// grow to n entries so every node is copied at most once. The mutation
+// tracking map is also pre-allocated, up to its usual bound. Over or under
+// estimating n only affects performance and memory use during the
+// transaction, never the resulting tree.
+func (t *Tree[T]) TxnWithCapacity(n int) *Txn[T] {
+	txn := t.Txn()
+	txn.capacity = n
+	return txn
+}
+
 // Clone makes an independent copy of the transaction. The new transaction
 // does not track any nodes and has TrackMutate turned off. The cloned transaction will contain any uncommitted writes in the original transaction but further mutations to either will be independent and result in different radix trees on Commit. A cloned transaction may be passed to another goroutine and mutated there independently however each transaction may only be mutated in a single thread.
 func (t *Txn[T]) Clone() *Txn[T] {
+	t.checkUsable()
+
 	// reset the writable node cache to avoid leaking future writes into the clone
 	t.writable = nil
 
 	txn := &Txn[T]{
-		root: t.root,
-		snap: t.snap,
-		size: t.size,
+		root:     t.root,
+		snap:     t.snap,
+		size:     t.size,
+		capacity: t.capacity,
 	}
 	return txn
 }
 
+// checkUsable panics with ErrTxnCommitted if the transaction has already been
+// committed.
+func (t *Txn[T]) checkUsable() {
+	if t.committed {
+		panic(ErrTxnCommitted)
+	}
+}
+
 // TrackMutate can be used to toggle if mutations are tracked. If this is enabled
 // then notifications will be issued for affected internal nodes and leaves when
 // the transaction is committed.
@@ -135,7 +244,7 @@ func (t *Txn[T]) trackChannel(ch chan struct{}) {
 
 	// Create the map on the fly when we need it.
 	if t.trackChannels == nil {
-		t.trackChannels = make(map[chan struct{}]struct{})
+		t.trackChannels = make(map[chan struct{}]struct{}, min(t.capacity, defaultModifiedCache))
 	}
 
 	// Otherwise we are good to track it.
@@ -149,7 +258,7 @@ func (t *Txn[T]) trackChannel(ch chan struct{}) {
 func (t *Txn[T]) writeNode(n *Node[T], forLeafUpdate bool) *Node[T] {
 	// Ensure the writable set exists.
 	if t.writable == nil {
-		lru, err := simplelru.NewLRU[*Node[T], any](defaultModifiedCache, nil)
+		lru, err := simplelru.NewLRU[*Node[T], any](max(t.capacity, defaultModifiedCache), nil)
 		if err != nil {
 			panic(err)
 		}
@@ -162,6 +271,7 @@ func (t *Txn[T]) writeNode(n *Node[T], forLeafUpdate bool) *Node[T] {
 	// update we track it, in case the initial write to this node didn't
 	// update the leaf.
 	if _, ok := t.writable.Get(n); ok {
+		t.reuses++
 		if t.trackMutate && forLeafUpdate && n.leaf != nil {
 			t.trackChannel(n.leaf.mutateCh)
 		}
@@ -178,17 +288,22 @@ func (t *Txn[T]) writeNode(n *Node[T], forLeafUpdate bool) *Node[T] {
 		t.trackChannel(n.leaf.mutateCh)
 	}
 
+	t.copies++
+
 	// Copy the existing node. If you have set forLeafUpdate it will be
 	// safe to replace this leaf with another after you get your node for
 	// writing. You MUST replace it, because the channel associated with
 	// this leaf will be closed when this transaction is committed.
+	//
+	// The prefix is shared with the original rather than copied. Prefixes are
+	// never modified in place, only resliced or replaced with new slices, so
+	// every version of a node can point into the same bytes, which are
+	// usually part of the key that first created the node.
 	nc := &Node[T]{
 		mutateCh: make(chan struct{}),
 		leaf:     n.leaf,
-	}
-	if n.prefix != nil {
-		nc.prefix = make([]byte, len(n.prefix))
-		copy(nc.prefix, n.prefix)
+		prefix:   n.prefix,
+		size:     n.size,
 	}
 	if len(n.edges) != 0 {
 		nc.edges = make([]edge[T], len(n.edges))
@@ -200,6 +315,20 @@ func (t *Txn[T]) writeNode(n *Node[T], forLeafUpdate bool) *Node[T] {
 	return nc
 }
 
+// refreshNode is called once a node that is being returned up the write path
+// has been fully modified, and its children are final. This recomputes any
+// state that's derived from the node's subtree.
+func (t *Txn[T]) refreshNode(n *Node[T]) {
+	size := 0
+	if n.leaf != nil {
+		size = 1
+	}
+	for _, e := range n.edges {
+		size += e.node.size
+	}
+	n.size = size
+}
+
 // Visit all the nodes in the tree under n, and add their mutateChannels to the transaction
 // Returns the size of the subtree visited
 func (t *Txn[T]) trackChannelsAndCount(n *Node[T]) int {
@@ -248,8 +377,9 @@ func (t *Txn[T]) mergeChild(n *Node[T]) {
 	}
 }
 
-// insert does a recursive insertion
-func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
+// insert does a recursive insertion of the given new leaf, which is placed
+// under the remaining search key.
+func (t *Txn[T]) insert(n *Node[T], search []byte, leaf *leafNode[T]) (*Node[T], T, bool) {
 	var zero T
 
 	// Handle key exhaustion
@@ -262,11 +392,8 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 		}
 
 		nc := t.writeNode(n, true)
-		nc.leaf = &leafNode[T]{
-			mutateCh: make(chan struct{}),
-			key:      k,
-			val:      v,
-		}
+		nc.leaf = leaf
+		t.refreshNode(nc)
 		return nc, oldVal, didUpdate
 	}
 
@@ -279,16 +406,14 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 			label: search[0],
 			node: &Node[T]{
 				mutateCh: make(chan struct{}),
-				leaf: &leafNode[T]{
-					mutateCh: make(chan struct{}),
-					key:      k,
-					val:      v,
-				},
-				prefix: search,
+				leaf:     leaf,
+				prefix:   search,
 			},
 		}
+		t.refreshNode(e.node)
 		nc := t.writeNode(n, false)
 		nc.addEdge(e)
+		t.refreshNode(nc)
 		return nc, zero, false
 	}
 
@@ -296,10 +421,11 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 	commonPrefix := longestPrefix(search, child.prefix)
 	if commonPrefix == len(child.prefix) {
 		search = search[commonPrefix:]
-		newChild, oldVal, didUpdate := t.insert(child, k, search, v)
+		newChild, oldVal, didUpdate := t.insert(child, search, leaf)
 		if newChild != nil {
 			nc := t.writeNode(n, false)
 			nc.edges[idx].node = newChild
+			t.refreshNode(nc)
 			return nc, oldVal, didUpdate
 		}
 		return nil, oldVal, didUpdate
@@ -324,29 +450,28 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 	})
 	modChild.prefix = modChild.prefix[commonPrefix:]
 
-	// Create a new leaf node
-	leaf := &leafNode[T]{
-		mutateCh: make(chan struct{}),
-		key:      k,
-		val:      v,
-	}
-
 	// If the new key is a subset, add to to this node
 	search = search[commonPrefix:]
 	if len(search) == 0 {
 		splitNode.leaf = leaf
+		t.refreshNode(splitNode)
+		t.refreshNode(nc)
 		return nc, zero, false
 	}
 
 	// Create a new edge for the node
+	leafNode := &Node[T]{
+		mutateCh: make(chan struct{}),
+		leaf:     leaf,
+		prefix:   search,
+	}
 	splitNode.addEdge(edge[T]{
 		label: search[0],
-		node: &Node[T]{
-			mutateCh: make(chan struct{}),
-			leaf:     leaf,
-			prefix:   search,
-		},
+		node:  leafNode,
 	})
+	t.refreshNode(leafNode)
+	t.refreshNode(splitNode)
+	t.refreshNode(nc)
 	return nc, zero, false
 }
 
@@ -371,6 +496,7 @@ func (t *Txn[T]) delete(n *Node[T], search []byte) (*Node[T], *leafNode[T]) {
 		if n != t.root && len(nc.edges) == 1 {
 			t.mergeChild(nc)
 		}
+		t.refreshNode(nc)
 		return nc, oldLeaf
 	}
 
@@ -403,6 +529,7 @@ func (t *Txn[T]) delete(n *Node[T], search []byte) (*Node[T], *leafNode[T]) {
 	} else {
 		nc.edges[idx].node = newChild
 	}
+	t.refreshNode(nc)
 	return nc, leaf
 }
 
@@ -410,12 +537,16 @@ func (t *Txn[T]) delete(n *Node[T], search []byte) (*Node[T], *leafNode[T]) {
 func (t *Txn[T]) deletePrefix(n *Node[T], search []byte) (*Node[T], int) {
 	// Check for key exhaustion
 	if len(search) == 0 {
+		// Count the subtree before clearing it out, since n may already be
+		// writable in which case the write node below is n itself.
+		numDeletions := t.trackChannelsAndCount(n)
 		nc := t.writeNode(n, true)
 		if n.isLeaf() {
 			nc.leaf = nil
 		}
 		nc.edges = nil
-		return nc, t.trackChannelsAndCount(n)
+		t.refreshNode(nc)
+		return nc, numDeletions
 	}
 
 	// Look for an edge
@@ -453,25 +584,147 @@ func (t *Txn[T]) deletePrefix(n *Node[T], search []byte) (*Node[T], int) {
 	} else {
 		nc.edges[idx].node = newChild
 	}
+	t.refreshNode(nc)
 	return nc, numDeletions
 }
 
 // Insert is used to add or update a given key. The return provides
 // the previous value and a bool indicating if any was set.
+//
+// The key is never copied: the tree keeps the given slice as the entry's key,
+// and the node prefixes along its path are sub-slices of it. That makes bulk
+// loads from one large buffer cheap, but the caller must not modify the slice
+// afterwards, since that would silently change the key in this tree and in
+// every tree derived from it. Copy the key first if the buffer is reused.
 func (t *Txn[T]) Insert(k []byte, v T) (T, bool) {
-	newRoot, oldVal, didUpdate := t.insert(t.root, k, k, v)
+	return t.insertLeaf(k, v, false)
+}
+
+// InsertLiteral is like Insert, but marks the key as literal data so that the
+// wildcard matchers never interpret it as a pattern, even if it is "*" or ends
+// in ".*". A literal key is still found by Get and iteration as usual, and is
+// matched by MatchWithWildcards only when the input is exactly the same key.
+// Inserting the same key again with Insert clears the mark.
+func (t *Txn[T]) InsertLiteral(k []byte, v T) (T, bool) {
+	return t.insertLeaf(k, v, true)
+}
+
+// insertLeaf does the work of Insert and InsertLiteral.
+func (t *Txn[T]) insertLeaf(k []byte, v T, literal bool) (T, bool) {
+	return t.insertNewLeaf(&leafNode[T]{
+		mutateCh: make(chan struct{}),
+		key:      k,
+		val:      v,
+		literal:  literal,
+	})
+}
+
+// reinsertLeaf inserts the value of an existing leaf under the key k, for the
+// operations that move entries around. The entry stays literal if it was, but
+// the original key from InsertNormalized is only kept if k is the leaf's own
+// key, since it doesn't describe any other key.
+func (t *Txn[T]) reinsertLeaf(k []byte, l *leafNode[T]) (T, bool) {
+	leaf := &leafNode[T]{
+		mutateCh: make(chan struct{}),
+		key:      k,
+		val:      l.val,
+		literal:  l.literal,
+	}
+	if bytes.Equal(k, l.key) {
+		leaf.orig = l.orig
+	}
+	return t.insertNewLeaf(leaf)
+}
+
+// insertNewLeaf inserts the given leaf under its key, replacing any existing
+// leaf for that key.
+func (t *Txn[T]) insertNewLeaf(leaf *leafNode[T]) (T, bool) {
+	t.checkUsable()
+	newRoot, oldVal, didUpdate := t.insert(t.root, leaf.key, leaf)
 	if newRoot != nil {
 		t.root = newRoot
 	}
-	if !didUpdate {
+	if didUpdate {
+		t.replaced++
+	} else {
 		t.size++
+		t.added++
 	}
 	return oldVal, didUpdate
 }
 
+// InsertNormalized is like Insert, but keys the entry on norm(k) while keeping
+// k itself as the entry's original key. This allows lookups that ignore some
+// difference between keys, such as case, while still being able to give back
+// the key exactly as it was inserted. The original key is stored in the leaf
+// next to the value, so T is unaffected, and GetNormalized and IterateOriginal
+// return it. Get, the other iterators and the other lookups only ever see the
+// normalized key. Inserting
+// the same normalized key again replaces the original key too, and a plain
+// Insert of it clears it. The norm function must not modify its argument.
+func (t *Txn[T]) InsertNormalized(k []byte, v T, norm func([]byte) []byte) (T, bool) {
+	return t.insertNewLeaf(&leafNode[T]{
+		mutateCh: make(chan struct{}),
+		key:      norm(k),
+		val:      v,
+		orig:     &k,
+	})
+}
+
+// InsertResult describes the outcome of inserting a key.
+type InsertResult int
+
+const (
+	// Added means the key wasn't previously set.
+	Added InsertResult = iota
+
+	// Replaced means the key was set and its value has been replaced.
+	Replaced
+)
+
+func (r InsertResult) String() string {
+	switch r {
+	case Added:
+		return "added"
+	case Replaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// InsertCounting is like Insert, but reports whether the key was added or an
+// existing value was replaced.
+func (t *Txn[T]) InsertCounting(k []byte, v T) InsertResult {
+	if _, didUpdate := t.Insert(k, v); didUpdate {
+		return Replaced
+	}
+	return Added
+}
+
+// Counts returns the number of keys that have been added, replaced and deleted
+// by this transaction so far. Every transaction starts with zero counts,
+// including one created by Clone.
+func (t *Txn[T]) Counts() (added, replaced, deleted int) {
+	return t.added, t.replaced, t.deleted
+}
+
+// AllocStats returns the number of nodes this transaction has copied so that
+// it could modify them, and the number of times it has been able to modify a
+// node it had already copied instead. Nodes created outright for new keys
+// aren't counted. A write should only copy the nodes on the path to its key,
+// so comparing these with the number of writes shows how well copy-on-write
+// is doing, for example to catch regressions in benchmarks. The counts are
+// always kept, at the cost of an increment per node written, and start from
+// zero for every transaction, including one created by Clone.
+func (t *Txn[T]) AllocStats() (copied, reused int) {
+	return t.copies, t.reuses
+}
+
 // Delete is used to delete a given key. Returns the old value if any,
 // and a bool indicating if the key was set.
 func (t *Txn[T]) Delete(k []byte) (T, bool) {
+	t.checkUsable()
 	var zero T
 	newRoot, leaf := t.delete(t.root, k)
 	if newRoot != nil {
@@ -479,24 +732,169 @@ func (t *Txn[T]) Delete(k []byte) (T, bool) {
 	}
 	if leaf != nil {
 		t.size--
+		t.deleted++
 		return leaf.val, true
 	}
 	return zero, false
 }
 
+// Move moves the value for the key from to the key to, as if from was deleted
+// and its value inserted under to, returning false without changing anything
+// if from isn't set. If to is already set its value is overwritten. A key that
+// was inserted with InsertLiteral stays literal under its new name, but the
+// original key from InsertNormalized is discarded unless to is the same as
+// from. When mutation tracking is on, the watches for both keys are fired on
+// commit.
+func (t *Txn[T]) Move(from, to []byte) (moved bool) {
+	t.checkUsable()
+	newRoot, leaf := t.delete(t.root, from)
+	if leaf == nil {
+		return false
+	}
+	if newRoot != nil {
+		t.root = newRoot
+	}
+	t.size--
+	t.deleted++
+	t.reinsertLeaf(to, leaf)
+	return true
+}
+
+// RewriteKeys moves every entry under the given prefix to the key returned by
+// rewrite for it, returning the number of entries rewritten. All the entries
+// are gathered and deleted before any are inserted under their new keys, so
+// one entry can take the old key of another. If several keys are rewritten to
+// the same key, the last of them in key order wins, and a rewritten key
+// overwrites any entry that was already there, including one outside the
+// prefix, where rewritten keys are allowed to land. Returning the same key
+// leaves the entry where it is, along with its original key if it was inserted
+// with InsertNormalized, which is otherwise discarded like it is by Move. Keys
+// inserted with InsertLiteral stay literal.
+// The rewrite function must not modify the key it's given, and the tree
+// retains the key it returns, like Insert. When mutation tracking is on, the
+// watches for the old and new keys are fired on commit.
+func (t *Txn[T]) RewriteKeys(prefix []byte, rewrite func(key []byte) []byte) int {
+	t.checkUsable()
+	var moving []*leafNode[T]
+	if pn := t.root.prefixNode(prefix); pn != nil {
+		walkLeaves(pn, func(l *leafNode[T]) {
+			moving = append(moving, l)
+		})
+	}
+	if len(moving) == 0 {
+		return 0
+	}
+	t.DeletePrefix(prefix)
+	for _, l := range moving {
+		t.reinsertLeaf(rewrite(l.key), l)
+	}
+	return len(moving)
+}
+
+// DeleteN deletes each of the given keys, returning how many of them were
+// set and removed, along with the number of keys left in the transaction
+// afterwards. Keys that aren't set, or are repeated, are skipped. The size is
+// tracked as the transaction goes, so newLen costs nothing extra.
+func (t *Txn[T]) DeleteN(keys [][]byte) (removed int, newLen int) {
+	for _, k := range keys {
+		if _, ok := t.Delete(k); ok {
+			removed++
+		}
+	}
+	return removed, t.size
+}
+
 // DeletePrefix is used to delete an entire subtree that matches the prefix
 // This will delete all nodes under that prefix
 func (t *Txn[T]) DeletePrefix(prefix []byte) bool {
+	t.checkUsable()
 	newRoot, numDeletions := t.deletePrefix(t.root, prefix)
 	if newRoot != nil {
 		t.root = newRoot
 		t.size = t.size - numDeletions
+		t.deleted += numDeletions
 		return true
 	}
 	return false
 
 }
 
+// Graft inserts every entry of sub under the given prefix, so that each key k
+// in sub is set as prefix+k in this transaction, and returns the number of
+// keys that weren't already present. Keys that are already present are
+// overwritten with the value from sub. Every leaf stores its own full key, so
+// sub's nodes can't be attached as they are even though they're immutable;
+// each entry is inserted with a newly allocated key instead, and sub isn't
+// modified. Keys inserted into sub with InsertLiteral stay literal, but the
+// original keys from InsertNormalized are dropped unless the prefix is empty,
+// so GetNormalized gives back the new keys.
+func (t *Txn[T]) Graft(prefix []byte, sub *Tree[T]) int {
+	t.checkUsable()
+	added := 0
+	walkLeaves(sub.root, func(leaf *leafNode[T]) {
+		if _, replaced := t.reinsertLeaf(concat(prefix, leaf.key), leaf); !replaced {
+			added++
+		}
+	})
+	return added
+}
+
+// DeleteAll deletes every key in the transaction's tree, returning the number
+// of keys deleted. Unlike starting over with an empty tree, this is a normal
+// write, so with TrackMutate enabled the commit closes the watch channels of
+// every node and leaf that was in the tree, and watchers on any key or prefix
+// are told that it was cleared.
+func (t *Txn[T]) DeleteAll() int {
+	size := t.size
+	t.DeletePrefix(nil)
+	return size - t.size
+}
+
+// DeletePrefixFunc deletes the keys under the given prefix for which pred
+// returns true, returning the number of keys deleted. Only the subtree under
+// the prefix is visited, and the matching keys are gathered before any are
+// deleted, so pred always sees the entries as they were before the call.
+func (t *Txn[T]) DeletePrefixFunc(prefix []byte, pred func(k []byte, v T) bool) int {
+	t.checkUsable()
+	var doomed [][]byte
+	t.root.WalkPrefix(prefix, func(k []byte, v T) bool {
+		if pred(k, v) {
+			doomed = append(doomed, k)
+		}
+		return false
+	})
+	for _, k := range doomed {
+		t.Delete(k)
+	}
+	return len(doomed)
+}
+
+// UpdateValues calls fn for every entry in the transaction, in key order, and
+// replaces the value of each entry for which it returns true with the value it
+// returns, leaving the rest as they are. Entries that aren't replaced don't
+// cause any nodes to be copied, so they stay shared with earlier versions of
+// the tree, and only the watches for the replaced keys fire. Like
+// DeletePrefixFunc, the replacements are gathered before any are made, so fn
+// always sees the entries as they were before the call.
+func (t *Txn[T]) UpdateValues(fn func(key []byte, v T) (T, bool)) {
+	t.checkUsable()
+	var updates []*leafNode[T]
+	walkLeaves(t.root, func(l *leafNode[T]) {
+		if v, ok := fn(l.key, l.val); ok {
+			updates = append(updates, &leafNode[T]{
+				mutateCh: make(chan struct{}),
+				key:      l.key,
+				val:      v,
+				literal:  l.literal,
+				orig:     l.orig,
+			})
+		}
+	})
+	for _, l := range updates {
+		t.insertNewLeaf(l)
+	}
+}
+
 // Root returns the current root of the radix tree within this
 // transaction. The root is not safe across insert and delete operations,
 // but can be used to read the current state during a transaction.
@@ -507,15 +905,24 @@ func (t *Txn[T]) Root() *Node[T] {
 // Get is used to lookup a specific key, returning
 // the value and if it was found
 func (t *Txn[T]) Get(k []byte) (T, bool) {
+	t.checkUsable()
 	return t.root.Get(k)
 }
 
 // GetWatch is used to lookup a specific key, returning
 // the watch channel, value and if it was found
 func (t *Txn[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
+	t.checkUsable()
 	return t.root.GetWatch(k)
 }
 
+// GetNormalized is used to lookup the entry for norm(k) as inserted by
+// InsertNormalized, returning the original key, the value and if it was found.
+func (t *Txn[T]) GetNormalized(k []byte, norm func([]byte) []byte) ([]byte, T, bool) {
+	t.checkUsable()
+	return t.root.GetNormalized(k, norm)
+}
+
 // Commit is used to finalize the transaction and return a new tree. If mutation
 // tracking is turned on then notifications will also be issued.
 func (t *Txn[T]) Commit() *Tree[T] {
@@ -526,9 +933,42 @@ func (t *Txn[T]) Commit() *Tree[T] {
 	return nt
 }
 
+// Snapshot returns a tree holding the transaction's work so far, without
+// committing it. The snapshot is immutable like any other tree, and further
+// writes to the transaction don't affect it, so it can be handed to another
+// goroutine while the transaction carries on. To make that so, the
+// transaction forgets which nodes it has already copied, so the next write to
+// each of them will copy it again.
+func (t *Txn[T]) Snapshot() *Tree[T] {
+	t.checkUsable()
+	t.writable = nil
+	return &Tree[T]{t.root, t.size}
+}
+
+// CommitWithUndo is like Commit, but also returns a function that gives back
+// the tree as it was when the transaction was started. Since trees are
+// immutable this is just the old snapshot, not a replay of the inverse
+// changes, so it's cheap and can be called any number of times. Note that if
+// TrackMutate was enabled, the commit will have closed the watch channels in
+// the old snapshot for everything it changed, so watches taken on the tree
+// returned by undo will fire straight away for those parts.
+func (t *Txn[T]) CommitWithUndo() (*Tree[T], func() *Tree[T]) {
+	t.checkUsable()
+	prev := &Tree[T]{t.snap, t.snap.size}
+	return t.Commit(), func() *Tree[T] { return prev }
+}
+
 // CommitOnly is used to finalize the transaction and return a new tree, but
 // does not issue any notifications until Notify is called.
 func (t *Txn[T]) CommitOnly() *Tree[T] {
+	t.checkUsable()
+	t.committed = true
+
+	// The root is always written last, so if it's still in the writable
+	// cache it's safe to set its wildcard flag before it's published.
+	if t.writable != nil && t.writable.Contains(t.root) {
+		t.root.wild = wildcardFlagFor(t.root)
+	}
 	nt := &Tree[T]{t.root, t.size}
 	t.writable = nil
 	return nt
@@ -629,6 +1069,14 @@ func (t *Tree[T]) Insert(k []byte, v T) (*Tree[T], T, bool) {
 	return txn.Commit(), old, ok
 }
 
+// InsertLiteral is like Insert, but marks the key as literal data that is
+// never interpreted as a wildcard pattern. See Txn.InsertLiteral.
+func (t *Tree[T]) InsertLiteral(k []byte, v T) (*Tree[T], T, bool) {
+	txn := t.Txn()
+	old, ok := txn.InsertLiteral(k, v)
+	return txn.Commit(), old, ok
+}
+
 // Delete is used to delete a given key. Returns the new tree,
 // old value if any, and a bool indicating if the key was set.
 func (t *Tree[T]) Delete(k []byte) (*Tree[T], T, bool) {
@@ -4,10 +4,13 @@
 package iradix
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"testing/quick"
 
@@ -28,6 +31,8 @@ func CopyNode[T any](n *Node[T]) *Node[T] {
 	if n.mutateCh != nil {
 		nn.mutateCh = n.mutateCh
 	}
+	nn.size = n.size
+	nn.wild = n.wild
 	if n.prefix != nil {
 		nn.prefix = make([]byte, len(n.prefix))
 		copy(nn.prefix, n.prefix)
@@ -50,6 +55,7 @@ func CopyLeaf[T any](l *leafNode[T]) *leafNode[T] {
 		mutateCh: l.mutateCh,
 		key:      l.key,
 		val:      l.val,
+		literal:  l.literal,
 	}
 	return ll
 }
@@ -738,6 +744,128 @@ func TestIteratePrefix(t *testing.T) {
 	}
 }
 
+func TestIterateRetainedKeys(t *testing.T) {
+	r := New[int]()
+	keys := []string{
+		"foo/bar/baz",
+		"foo/baz/bar",
+		"foo/zip/zap",
+		"foobar",
+		"zipzap",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	// Hold on to every key yielded by a completed iteration.
+	var retained [][]byte
+	iter := r.Root().Iterator()
+	for key, _, ok := iter.Next(); ok; key, _, ok = iter.Next() {
+		retained = append(retained, key)
+	}
+
+	// Mutate the tree heavily, including splitting and merging the nodes
+	// that the retained keys were yielded from.
+	txn := r.Txn()
+	for _, k := range keys {
+		txn.Insert([]byte(k+"/child"), 0)
+		txn.Insert([]byte(k[:len(k)-1]), 0)
+	}
+	for _, k := range keys {
+		txn.Delete([]byte(k))
+	}
+	txn.DeletePrefix([]byte("foo"))
+	txn.Commit()
+
+	// A second iteration over a different tree must not disturb them
+	// either.
+	iter = txn.Root().Iterator()
+	for _, _, ok := iter.Next(); ok; _, _, ok = iter.Next() {
+	}
+
+	if len(retained) != len(keys) {
+		t.Fatalf("bad len: %v %v", len(retained), len(keys))
+	}
+	for i, k := range keys {
+		if string(retained[i]) != k {
+			t.Fatalf("retained key changed: %q %q", retained[i], k)
+		}
+	}
+}
+
+func TestIterateCursor(t *testing.T) {
+	r := New[int]()
+	keys := []string{
+		"",
+		"a",
+		"ab",
+		"abc",
+		"b",
+		"ba",
+		"c",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	iter := r.Root().Iterator()
+	if c := iter.Cursor(); c != nil {
+		t.Fatalf("bad: %q", c)
+	}
+
+	// Yield a few keys, the first being the empty key which must give a
+	// non-nil cursor.
+	key, _, _ := iter.Next()
+	if c := iter.Cursor(); c == nil || len(c) != 0 || len(key) != 0 {
+		t.Fatalf("bad: %q", c)
+	}
+	iter.Next()
+	iter.Next()
+	cursor := iter.Cursor()
+	if string(cursor) != "ab" {
+		t.Fatalf("bad: %q", cursor)
+	}
+
+	// Make some unrelated changes, including deleting the cursor key itself
+	// and adding keys on either side of it.
+	txn := r.Txn()
+	txn.Insert([]byte("aa"), 100)
+	txn.Insert([]byte("abb"), 101)
+	txn.Insert([]byte("bb"), 102)
+	txn.Delete([]byte("ab"))
+	r = txn.Commit()
+
+	iter = r.Root().Iterator()
+	iter.Resume(cursor)
+	if c := iter.Cursor(); string(c) != "ab" {
+		t.Fatalf("bad: %q", c)
+	}
+	var out []string
+	for key, _, ok := iter.Next(); ok; key, _, ok = iter.Next() {
+		out = append(out, string(key))
+	}
+	expect := []string{"abb", "abc", "b", "ba", "bb", "c"}
+	if !slices.Equal(out, expect) {
+		t.Fatalf("mis-match: %v %v", out, expect)
+	}
+	if c := iter.Cursor(); string(c) != "c" {
+		t.Fatalf("bad: %q", c)
+	}
+
+	// The empty key cursor resumes after the empty key, and a nil cursor
+	// starts from the beginning.
+	iter = r.Root().Iterator()
+	iter.Resume([]byte{})
+	if key, _, _ := iter.Next(); string(key) != "a" {
+		t.Fatalf("bad: %q", key)
+	}
+	iter = r.Root().Iterator()
+	iter.Resume(nil)
+	if key, _, ok := iter.Next(); !ok || len(key) != 0 {
+		t.Fatalf("bad: %q", key)
+	}
+}
+
 func TestMergeChildNilEdges(t *testing.T) {
 	r := New[int]()
 	r, _, _ = r.Insert([]byte("foobar"), 42)
@@ -1873,3 +2001,1508 @@ func TestClone(t *testing.T) {
 		t.Fatalf("bad baz in t2")
 	}
 }
+
+func TestTxnCounts(t *testing.T) {
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("foo"), 1)
+	r, _, _ = r.Insert([]byte("foo/bar"), 2)
+	r, _, _ = r.Insert([]byte("foo/baz"), 3)
+
+	txn := r.Txn()
+	if res := txn.InsertCounting([]byte("zip"), 4); res != Added {
+		t.Fatalf("bad: %v", res)
+	}
+	if res := txn.InsertCounting([]byte("foo"), 5); res != Replaced {
+		t.Fatalf("bad: %v", res)
+	}
+	if res := txn.InsertCounting([]byte("zip"), 6); res != Replaced {
+		t.Fatalf("bad: %v", res)
+	}
+	txn.Insert([]byte("zap"), 7)
+	txn.Delete([]byte("foo"))
+	txn.Delete([]byte("nope"))
+	txn.DeletePrefix([]byte("foo/"))
+
+	added, replaced, deleted := txn.Counts()
+	if added != 2 || replaced != 2 || deleted != 3 {
+		t.Fatalf("bad: %d %d %d", added, replaced, deleted)
+	}
+	r = txn.Commit()
+	if r.Len() != 2 {
+		t.Fatalf("bad len: %d", r.Len())
+	}
+
+	// Counts start over with each transaction.
+	txn = r.Txn()
+	if added, replaced, deleted := txn.Counts(); added != 0 || replaced != 0 || deleted != 0 {
+		t.Fatalf("bad: %d %d %d", added, replaced, deleted)
+	}
+	txn.Insert([]byte("zap"), 8)
+	if added, replaced, deleted := txn.Clone().Counts(); added != 0 || replaced != 0 || deleted != 0 {
+		t.Fatalf("bad: %d %d %d", added, replaced, deleted)
+	}
+	if added, replaced, deleted := txn.Counts(); added != 0 || replaced != 1 || deleted != 0 {
+		t.Fatalf("bad: %d %d %d", added, replaced, deleted)
+	}
+}
+
+// checkSizes verifies that the cached size of every node in the tree matches
+// the number of leaves beneath it.
+func checkSizes[T any](t *testing.T, n *Node[T]) int {
+	t.Helper()
+	size := 0
+	if n.isLeaf() {
+		size++
+	}
+	for _, e := range n.edges {
+		size += checkSizes(t, e.node)
+	}
+	if n.size != size {
+		t.Fatalf("bad size for node %q: %d %d", n.prefix, n.size, size)
+	}
+	return size
+}
+
+func TestNodeSizes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "abc/"
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	r := New[int]()
+	for i := 0; i < 200; i++ {
+		txn := r.Txn()
+		for j := 0; j < 10; j++ {
+			switch rnd.Intn(5) {
+			case 0, 1:
+				txn.Delete(randKey())
+			case 2:
+				txn.DeletePrefix(randKey())
+			default:
+				txn.Insert(randKey(), j)
+			}
+			if got := checkSizes(t, txn.Root()); got != txn.size {
+				t.Fatalf("bad: %d %d", got, txn.size)
+			}
+		}
+		r = txn.Commit()
+	}
+}
+
+func TestIterateRemaining(t *testing.T) {
+	r := New[int]()
+	keys := []string{
+		"foo",
+		"foo/bar",
+		"foo/bar/baz",
+		"foo/baz/bar",
+		"foo/zip/zap",
+		"foobar",
+		"zipzap",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	// Count down through the whole tree.
+	iter := r.Root().Iterator()
+	for i := len(keys); i > 0; i-- {
+		if got := iter.Remaining(); got != i {
+			t.Fatalf("bad: %d %d", got, i)
+		}
+		iter.Next()
+	}
+	if got := iter.Remaining(); got != 0 {
+		t.Fatalf("bad: %d", got)
+	}
+
+	// And under prefixes, including one that ends part way along an edge.
+	type exp struct {
+		prefix string
+		out    int
+	}
+	cases := []exp{
+		{"foo", 6},
+		{"foo/", 4},
+		{"foo/b", 3},
+		{"foo/bar", 2},
+		{"fo", 6},
+		{"zip", 1},
+		{"nope", 0},
+	}
+	for _, test := range cases {
+		iter := r.Root().Iterator()
+		iter.SeekPrefix([]byte(test.prefix))
+		for i := test.out; i >= 0; i-- {
+			if got := iter.Remaining(); got != i {
+				t.Fatalf("bad: %q %d %d", test.prefix, got, i)
+			}
+			iter.Next()
+		}
+	}
+
+	// Lower bound seeks count everything after the bound.
+	iter = r.Root().Iterator()
+	iter.SeekLowerBound([]byte("foo/bas"))
+	if got := iter.Remaining(); got != 4 {
+		t.Fatalf("bad: %d", got)
+	}
+}
+
+func TestTxnCommitWithUndo(t *testing.T) {
+	hashV := func(v int) []byte { return []byte(strconv.Itoa(v)) }
+	r := New[int]()
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	orig := r.Root().ContentHash(hashV)
+
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	txn.Insert([]byte("foobaz"), 10)
+	txn.Delete([]byte("zip"))
+	txn.DeletePrefix([]byte("foob"))
+	nr, undo := txn.CommitWithUndo()
+	if nr.Len() != 1 || nr.Root().ContentHash(hashV) == orig {
+		t.Fatalf("bad: %d", nr.Len())
+	}
+
+	for i := 0; i < 2; i++ {
+		back := undo()
+		if back.Len() != 3 {
+			t.Fatalf("bad: %d", back.Len())
+		}
+		if back.Root().ContentHash(hashV) != orig {
+			t.Fatalf("undo didn't restore the original contents")
+		}
+	}
+
+	// Undoing an empty transaction is fine too.
+	nr, undo = New[int]().Txn().CommitWithUndo()
+	if nr.Len() != 0 || undo().Len() != 0 {
+		t.Fatalf("bad")
+	}
+}
+
+func TestTxnWithCapacity(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	keys := make([][]byte, 20000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("%08d", rnd.Intn(1000000)))
+	}
+
+	load := func(txn *Txn[int]) *Tree[int] {
+		for i, k := range keys {
+			txn.Insert(k, i)
+		}
+		return txn.Commit()
+	}
+
+	// Under, over and well estimated capacities all match a normal txn.
+	expect := load(New[int]().Txn())
+	for _, n := range []int{0, 10, len(keys), 10 * len(keys)} {
+		txn := New[int]().TxnWithCapacity(n)
+		txn.TrackMutate(true)
+		got := load(txn)
+		if got.Len() != expect.Len() {
+			t.Fatalf("bad: %d %d", got.Len(), expect.Len())
+		}
+		if !sameShape(got.Root(), expect.Root()) {
+			t.Fatalf("bad shape for capacity %d", n)
+		}
+		if diff := DiffString(expect, got, strconv.Itoa); diff != "" {
+			t.Fatalf("bad for capacity %d:\n%s", n, diff)
+		}
+	}
+}
+
+func benchmarkBulkLoad(b *testing.B, presize bool) {
+	const n = 1000000
+	rnd := rand.New(rand.NewSource(1))
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("%016x", rnd.Uint64()))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var txn *Txn[int]
+		if presize {
+			txn = New[int]().TxnWithCapacity(n)
+		} else {
+			txn = New[int]().Txn()
+		}
+		for j, k := range keys {
+			txn.Insert(k, j)
+		}
+		txn.Commit()
+	}
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	b.Run("Txn", func(b *testing.B) { benchmarkBulkLoad(b, false) })
+	b.Run("TxnWithCapacity", func(b *testing.B) { benchmarkBulkLoad(b, true) })
+}
+
+func TestTxnSnapshot(t *testing.T) {
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("base"), 0)
+
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key%03d", i)), i)
+	}
+	snap := txn.Snapshot()
+	hashV := func(v int) []byte { return []byte(strconv.Itoa(v)) }
+	before := snap.Root().ContentHash(hashV)
+
+	// Keep writing to the same nodes the snapshot shares, which the txn
+	// had already copied before the snapshot was taken.
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key%03d", i)), -i)
+		txn.Insert([]byte(fmt.Sprintf("key%03dx", i)), i)
+	}
+	txn.Delete([]byte("base"))
+	txn.DeletePrefix([]byte("key05"))
+	final := txn.Commit()
+
+	if snap.Len() != 101 {
+		t.Fatalf("bad: %d", snap.Len())
+	}
+	if snap.Root().ContentHash(hashV) != before {
+		t.Fatalf("snapshot changed")
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := snap.Get([]byte(fmt.Sprintf("key%03d", i))); !ok || v != i {
+			t.Fatalf("bad: %d %v %v", i, v, ok)
+		}
+		if _, ok := snap.Get([]byte(fmt.Sprintf("key%03dx", i))); ok {
+			t.Fatalf("post-snapshot insert visible")
+		}
+	}
+	if _, ok := snap.Get([]byte("base")); !ok {
+		t.Fatalf("post-snapshot delete visible")
+	}
+	checkSizes(t, snap.Root())
+
+	if final.Len() != 180 {
+		t.Fatalf("bad: %d", final.Len())
+	}
+	if v, ok := final.Get([]byte("key001")); !ok || v != -1 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if r.Len() != 1 {
+		t.Fatalf("bad: %d", r.Len())
+	}
+}
+
+func TestTxnDeletePrefixFunc(t *testing.T) {
+	r := New[int]()
+	keys := map[string]int{
+		"ns.a":     1,
+		"ns.a.x":   2,
+		"ns.a.y":   3,
+		"ns.b":     4,
+		"ns.bb":    5,
+		"ns":       6,
+		"other.a":  7,
+		"other.ns": 8,
+	}
+	for k, v := range keys {
+		r, _, _ = r.Insert([]byte(k), v)
+	}
+
+	var considered []string
+	txn := r.Txn()
+	n := txn.DeletePrefixFunc([]byte("ns."), func(k []byte, v int) bool {
+		considered = append(considered, string(k))
+		return v%2 == 1
+	})
+	nr := txn.Commit()
+
+	// Only the keys under the prefix were considered.
+	expect := []string{"ns.a", "ns.a.x", "ns.a.y", "ns.b", "ns.bb"}
+	if !reflect.DeepEqual(considered, expect) {
+		t.Fatalf("bad: %v", considered)
+	}
+	if n != 3 || nr.Len() != 5 {
+		t.Fatalf("bad: %d %d", n, nr.Len())
+	}
+	for k, v := range keys {
+		_, ok := nr.Get([]byte(k))
+		want := !(strings.HasPrefix(k, "ns.") && v%2 == 1)
+		if ok != want {
+			t.Fatalf("bad: %q %v", k, ok)
+		}
+	}
+
+	// Removing "ns.a" and "ns.a.y" leaves "ns.a.x" collapsed onto the
+	// "ns.a" edge.
+	checkCanonical(t, nr.Root())
+	checkSizes(t, nr.Root())
+
+	// Nothing under the prefix means nothing to delete.
+	txn = nr.Txn()
+	if n := txn.DeletePrefixFunc([]byte("nope"), func([]byte, int) bool { return true }); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := txn.DeletePrefixFunc(nil, func([]byte, int) bool { return true }); n != 5 {
+		t.Fatalf("bad: %d", n)
+	}
+	if txn.Commit().Len() != 0 {
+		t.Fatalf("expected an empty tree")
+	}
+}
+
+func TestIterateClone(t *testing.T) {
+	r := New[int]()
+	keys := []string{"a", "ab", "abc", "b", "ba", "c", "d"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	rest := func(it *Iterator[int]) []string {
+		var out []string
+		for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+			out = append(out, string(k))
+		}
+		return out
+	}
+
+	// Cloning before starting gives a full iteration each.
+	it := r.Root().Iterator()
+	c := it.Clone()
+	if got := rest(c); !reflect.DeepEqual(got, keys) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := rest(it); !reflect.DeepEqual(got, keys) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Clone part way through, then advance each in turn.
+	it = r.Root().Iterator()
+	it.Next()
+	it.Next()
+	c = it.Clone()
+	if k, _, _ := c.Next(); string(k) != "abc" {
+		t.Fatalf("bad: %q", k)
+	}
+	c.Next()
+	if k, _, _ := it.Next(); string(k) != "abc" {
+		t.Fatalf("original moved: %q", k)
+	}
+	if got := rest(it); !reflect.DeepEqual(got, keys[3:]) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := rest(c); !reflect.DeepEqual(got, keys[4:]) {
+		t.Fatalf("clone moved: %v", got)
+	}
+
+	// Seeked iterators clone too, along with their cursor.
+	it = r.Root().Iterator()
+	it.SeekLowerBound([]byte("ab"))
+	it.Next()
+	c = it.Clone()
+	if string(c.Cursor()) != "ab" {
+		t.Fatalf("bad: %q", c.Cursor())
+	}
+	if got := rest(c); !reflect.DeepEqual(got, keys[2:]) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := rest(it); !reflect.DeepEqual(got, keys[2:]) {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestTxnCommitted(t *testing.T) {
+	expectCommitted := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			t.Helper()
+			if r := recover(); r != ErrTxnCommitted {
+				t.Fatalf("bad: %s: %v", name, r)
+			}
+		}()
+		f()
+	}
+
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("foo"), 1)
+	ch, _, _ := r.Root().GetWatch([]byte("foo"))
+
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	txn.Insert([]byte("foo"), 2)
+	txn.Insert([]byte("bar"), 3)
+	nr := txn.CommitOnly()
+
+	expectCommitted("Insert", func() { txn.Insert([]byte("baz"), 4) })
+	expectCommitted("InsertLiteral", func() { txn.InsertLiteral([]byte("*"), 4) })
+	expectCommitted("InsertCounting", func() { txn.InsertCounting([]byte("baz"), 4) })
+	expectCommitted("Delete", func() { txn.Delete([]byte("foo")) })
+	expectCommitted("DeletePrefix", func() { txn.DeletePrefix([]byte("f")) })
+	expectCommitted("DeletePrefixFunc", func() {
+		txn.DeletePrefixFunc(nil, func([]byte, int) bool { return true })
+	})
+	expectCommitted("Get", func() { txn.Get([]byte("foo")) })
+	expectCommitted("GetWatch", func() { txn.GetWatch([]byte("foo")) })
+	expectCommitted("Clone", func() { txn.Clone() })
+	expectCommitted("Snapshot", func() { txn.Snapshot() })
+	expectCommitted("Commit", func() { txn.Commit() })
+	expectCommitted("CommitOnly", func() { txn.CommitOnly() })
+	expectCommitted("CommitWithUndo", func() { txn.CommitWithUndo() })
+
+	// None of that should have touched the committed tree.
+	if nr.Len() != 2 {
+		t.Fatalf("bad: %d", nr.Len())
+	}
+	if v, _ := nr.Get([]byte("foo")); v != 2 {
+		t.Fatalf("bad: %d", v)
+	}
+
+	// Notifying after CommitOnly is still allowed, and so is looking at the
+	// outcome.
+	select {
+	case <-ch:
+		t.Fatalf("notified too early")
+	default:
+	}
+	txn.Notify()
+	select {
+	case <-ch:
+	default:
+		t.Fatalf("expected a notification")
+	}
+	if added, replaced, _ := txn.Counts(); added != 1 || replaced != 1 {
+		t.Fatalf("bad: %d %d", added, replaced)
+	}
+	if txn.Root() != nr.Root() {
+		t.Fatalf("bad root")
+	}
+
+	// A fresh transaction on the committed tree works as usual.
+	txn = nr.Txn()
+	txn.Insert([]byte("baz"), 4)
+	if v, ok := txn.Get([]byte("baz")); !ok || v != 4 {
+		t.Fatalf("bad: %d %v", v, ok)
+	}
+	if nr2 := txn.Commit(); nr2.Len() != 3 {
+		t.Fatalf("bad: %d", nr2.Len())
+	}
+	expectCommitted("Insert", func() { txn.Insert([]byte("qux"), 5) })
+
+	// The tree-level helpers use a new transaction each time.
+	nr, _, _ = nr.Insert([]byte("qux"), 5)
+	nr, _, _ = nr.Delete([]byte("qux"))
+	if nr.Len() != 2 {
+		t.Fatalf("bad: %d", nr.Len())
+	}
+}
+
+func TestTxnInsertNormalized(t *testing.T) {
+	lower := func(k []byte) []byte { return bytes.ToLower(k) }
+
+	txn := New[int]().Txn()
+	if _, ok := txn.InsertNormalized([]byte("Foo.Bar"), 1, lower); ok {
+		t.Fatalf("expected a new key")
+	}
+	txn.InsertNormalized([]byte("API"), 2, lower)
+	txn.Insert([]byte("plain"), 3)
+	r := txn.Commit()
+
+	// Lookups with any casing find the entry and give back the original key.
+	for _, q := range []string{"foo.bar", "FOO.BAR", "Foo.Bar", "fOO.bAR"} {
+		k, v, ok := r.Root().GetNormalized([]byte(q), lower)
+		if !ok || string(k) != "Foo.Bar" || v != 1 {
+			t.Fatalf("bad: %q: %q %d %v", q, k, v, ok)
+		}
+	}
+	if k, _, ok := r.Root().GetNormalized([]byte("PLAIN"), lower); !ok || string(k) != "plain" {
+		t.Fatalf("bad: %q %v", k, ok)
+	}
+	if _, _, ok := r.Root().GetNormalized([]byte("nope"), lower); ok {
+		t.Fatalf("expected no match")
+	}
+
+	// The tree itself is keyed on the normalized form.
+	if v, ok := r.Get([]byte("api")); !ok || v != 2 {
+		t.Fatalf("bad: %d %v", v, ok)
+	}
+	if _, ok := r.Get([]byte("API")); ok {
+		t.Fatalf("expected no match for the original key")
+	}
+	var keys []string
+	r.Root().Walk(func(k []byte, _ int) bool {
+		keys = append(keys, string(k))
+		return false
+	})
+	if !reflect.DeepEqual(keys, []string{"api", "foo.bar", "plain"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// Re-inserting under a different casing replaces the original key, and a
+	// plain insert clears it.
+	txn = r.Txn()
+	if old, ok := txn.InsertNormalized([]byte("FOO.bar"), 4, lower); !ok || old != 1 {
+		t.Fatalf("bad: %d %v", old, ok)
+	}
+	if k, v, ok := txn.GetNormalized([]byte("foo.bar"), lower); !ok || string(k) != "FOO.bar" || v != 4 {
+		t.Fatalf("bad: %q %d %v", k, v, ok)
+	}
+	txn.Insert([]byte("api"), 5)
+	r2 := txn.Commit()
+	if r2.Len() != 3 {
+		t.Fatalf("bad: %d", r2.Len())
+	}
+	if k, v, ok := r2.Root().GetNormalized([]byte("Api"), lower); !ok || string(k) != "api" || v != 5 {
+		t.Fatalf("bad: %q %d %v", k, v, ok)
+	}
+
+	// The old tree still has the old original keys.
+	if k, _, _ := r.Root().GetNormalized([]byte("api"), lower); string(k) != "API" {
+		t.Fatalf("bad: %q", k)
+	}
+}
+
+func TestIterateOriginal(t *testing.T) {
+	lower := func(k []byte) []byte { return bytes.ToLower(k) }
+
+	txn := New[int]().Txn()
+	txn.InsertNormalized([]byte("Foo.Bar"), 1, lower)
+	txn.InsertNormalized([]byte("API"), 2, lower)
+	txn.Insert([]byte("foo.baz"), 3)
+	txn.InsertNormalized([]byte("Zed"), 4, lower)
+	r := txn.Commit()
+
+	collect := func(prefix string) []string {
+		var out []string
+		for k, v := range r.Root().IterateOriginal([]byte(prefix)) {
+			out = append(out, fmt.Sprintf("%s=%d", k, v))
+		}
+		return out
+	}
+
+	// The original keys come back in the order of the normalized ones, and
+	// plain entries are yielded with their key.
+	if got := collect(""); !reflect.DeepEqual(got, []string{"API=2", "Foo.Bar=1", "foo.baz=3", "Zed=4"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := collect("foo."); !reflect.DeepEqual(got, []string{"Foo.Bar=1", "foo.baz=3"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := collect("Foo."); got != nil {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Stopping early is respected.
+	n := 0
+	for range r.Root().IterateOriginal(nil) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Updating the values keeps the original keys.
+	txn = r.Txn()
+	txn.UpdateValues(func(_ []byte, v int) (int, bool) { return v * 10, true })
+	r = txn.Commit()
+	if got := collect("a"); !reflect.DeepEqual(got, []string{"API=20"}) {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestTxnDeleteAll(t *testing.T) {
+	r := New[int]()
+	keys := []string{"", "a", "ab", "abc", "b", "bc", "c.d.e"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	// Watch every key, and some prefixes that aren't keys.
+	var watches []<-chan struct{}
+	for _, k := range append(keys, "c", "c.d", "zzz") {
+		ch, _, _ := r.Root().GetWatch([]byte(k))
+		watches = append(watches, ch)
+		ch, _, _ = r.Root().GetWatch([]byte(k[:len(k)/2]))
+		watches = append(watches, ch)
+	}
+
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	if n := txn.DeleteAll(); n != len(keys) {
+		t.Fatalf("bad: %d", n)
+	}
+	if _, ok := txn.Get([]byte("a")); ok {
+		t.Fatalf("expected the key to be gone")
+	}
+	nr := txn.Commit()
+	if nr.Len() != 0 || nr.Root().size != 0 {
+		t.Fatalf("bad: %d", nr.Len())
+	}
+	checkCanonical(t, nr.Root())
+	for i, ch := range watches {
+		select {
+		case <-ch:
+		default:
+			t.Fatalf("watch %d not notified", i)
+		}
+	}
+
+	// The old tree is intact, and clearing an empty tree does nothing.
+	if r.Len() != len(keys) {
+		t.Fatalf("bad: %d", r.Len())
+	}
+	txn = nr.Txn()
+	if n := txn.DeleteAll(); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+	if _, _, deleted := txn.Counts(); deleted != 0 {
+		t.Fatalf("bad: %d", deleted)
+	}
+
+	// The cleared tree can be reused as normal.
+	txn = r.Txn()
+	txn.DeleteAll()
+	txn.Insert([]byte("x"), 1)
+	if nr := txn.Commit(); nr.Len() != 1 {
+		t.Fatalf("bad: %d", nr.Len())
+	}
+}
+
+func TestTreeClear(t *testing.T) {
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("a"), 1)
+	ch, _, _ := r.Root().GetWatch([]byte("a"))
+
+	c := r.Clear()
+	if c.Len() != 0 || c.Root().size != 0 {
+		t.Fatalf("bad: %d", c.Len())
+	}
+	if _, ok := r.Get([]byte("a")); !ok || r.Len() != 1 {
+		t.Fatalf("expected the original to be unchanged")
+	}
+	select {
+	case <-ch:
+		t.Fatalf("unexpected notification")
+	default:
+	}
+}
+
+func TestTxnAllocStats(t *testing.T) {
+	// Lots of keys sharing a long prefix, so the tree is wide at the
+	// bottom but every path to a key is short.
+	prefix := strings.Repeat("tenant.abc123.project.", 10)
+	r := New[int]()
+	txn := r.Txn()
+	for i := 0; i < 10000; i++ {
+		txn.Insert([]byte(prefix+strconv.Itoa(i)), i)
+	}
+	r = txn.Commit()
+
+	depth := func(k []byte) int {
+		d := 0
+		n, search := r.Root(), k
+		for len(search) > 0 {
+			_, n = n.getEdge(search[0])
+			if n == nil || !bytes.HasPrefix(search, n.prefix) {
+				break
+			}
+			search = search[len(n.prefix):]
+			d++
+		}
+		return d + 1
+	}
+
+	// Replacing a key only copies the nodes on its path.
+	k := []byte(prefix + "4242")
+	txn = r.Txn()
+	if copied, reused := txn.AllocStats(); copied != 0 || reused != 0 {
+		t.Fatalf("bad: %d %d", copied, reused)
+	}
+	txn.Insert(k, 0)
+	copied, reused := txn.AllocStats()
+	if copied != depth(k) || reused != 0 {
+		t.Fatalf("bad: %d %d, depth %d", copied, reused, depth(k))
+	}
+
+	// A new key under the same prefix copies at most one more node, for
+	// the split.
+	txn = r.Txn()
+	k = []byte(prefix + "42420")
+	txn.Insert(k, 0)
+	if copied, _ := txn.AllocStats(); copied > depth(k)+1 {
+		t.Fatalf("bad: %d, depth %d", copied, depth(k))
+	}
+
+	// A second write to the same path reuses the nodes the first copied.
+	txn = r.Txn()
+	txn.Insert([]byte(prefix+"1"), 0)
+	first, _ := txn.AllocStats()
+	txn.Insert([]byte(prefix+"1"), 1)
+	copied, reused = txn.AllocStats()
+	if copied != first || reused != first {
+		t.Fatalf("bad: %d %d, first %d", copied, reused, first)
+	}
+
+	// A clone starts from zero.
+	if copied, reused := txn.Clone().AllocStats(); copied != 0 || reused != 0 {
+		t.Fatalf("bad: %d %d", copied, reused)
+	}
+}
+
+func TestIteratePrefixIteratorAt(t *testing.T) {
+	r := New[int]()
+	keys := []string{"a", "ns", "ns.a", "ns.b", "ns.b.x", "ns.c", "nsx", "z"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	rest := func(it *Iterator[int]) []string {
+		out := []string{}
+		for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+			out = append(out, string(k))
+		}
+		return out
+	}
+
+	cases := []struct {
+		prefix string
+		after  string
+		out    []string
+	}{
+		{"ns.", "", []string{"ns.a", "ns.b", "ns.b.x", "ns.c"}},
+		{"ns.", "a", []string{"ns.a", "ns.b", "ns.b.x", "ns.c"}},
+		{"ns.", "ns", []string{"ns.a", "ns.b", "ns.b.x", "ns.c"}},
+		{"ns.", "ns.a", []string{"ns.b", "ns.b.x", "ns.c"}},
+		{"ns.", "ns.b", []string{"ns.b.x", "ns.c"}},
+		{"ns.", "ns.c", []string{}},
+		{"ns.", "nsx", []string{}},
+		{"ns", "ns", []string{"ns.a", "ns.b", "ns.b.x", "ns.c", "nsx"}},
+		{"n", "ns.b.x", []string{"ns.c", "nsx"}},
+		{"", "ns.c", []string{"nsx", "z"}},
+		{"nope", "", []string{}},
+		{"nope", "nope.a", []string{}},
+	}
+	for _, c := range cases {
+		it := r.Root().PrefixIteratorAt([]byte(c.prefix), []byte(c.after))
+		if got := rest(it); !reflect.DeepEqual(got, c.out) {
+			t.Fatalf("bad: %q after %q: %v", c.prefix, c.after, got)
+		}
+	}
+
+	// Page through a prefix, deleting keys between pages, including the
+	// one the cursor is on.
+	r = New[int]()
+	for i := 0; i < 100; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("a.%03d", i)), i)
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("b.%03d", i)), i)
+	}
+	var seen []string
+	var cursor []byte
+	for {
+		it := r.Root().PrefixIteratorAt([]byte("a."), cursor)
+		n := 0
+		for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+			seen = append(seen, string(k))
+			n++
+			if n == 7 {
+				break
+			}
+		}
+		if n == 0 {
+			break
+		}
+		cursor = it.Cursor()
+
+		// Delete the cursor and the key after it.
+		r, _, _ = r.Delete(cursor)
+		next, _ := strconv.Atoi(string(cursor[2:]))
+		r, _, _ = r.Delete([]byte(fmt.Sprintf("a.%03d", next+1)))
+	}
+	var expect []string
+	for i := 0; i < 100; i++ {
+		if i%8 != 7 {
+			expect = append(expect, fmt.Sprintf("a.%03d", i))
+		}
+	}
+	if !reflect.DeepEqual(seen, expect) {
+		t.Fatalf("bad: %v", seen)
+	}
+}
+
+func TestIteratePrefixIteratorAt_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab."
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 200; round++ {
+		r := New[int]()
+		for i := 0; i < rnd.Intn(30); i++ {
+			r, _, _ = r.Insert(randKey(), i)
+		}
+		for i := 0; i < 20; i++ {
+			prefix, after := randKey(), randKey()
+			prefix = prefix[:min(len(prefix), rnd.Intn(3))]
+			var expect []string
+			r.Root().WalkPrefix(prefix, func(k []byte, _ int) bool {
+				// An empty after starts at the beginning, even for the
+				// empty key.
+				if len(after) == 0 || bytes.Compare(k, after) > 0 {
+					expect = append(expect, string(k))
+				}
+				return false
+			})
+			var got []string
+			it := r.Root().PrefixIteratorAt(prefix, after)
+			for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+				got = append(got, string(k))
+			}
+			if !reflect.DeepEqual(got, expect) {
+				t.Fatalf("bad: %q after %q: %q, expected %q", prefix, after, got, expect)
+			}
+		}
+	}
+}
+
+func TestTxnGraft(t *testing.T) {
+	frag := New[int]()
+	for i, k := range []string{"", "db.host", "db.port", "log"} {
+		frag, _, _ = frag.Insert([]byte(k), i)
+	}
+
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("svc.a.db.port"), 100)
+	r, _, _ = r.Insert([]byte("svc.b"), 200)
+
+	txn := r.Txn()
+	if n := txn.Graft([]byte("svc.a."), frag); n != 3 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := txn.Graft([]byte("svc.b."), frag); n != 4 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := txn.Graft(nil, frag); n != 4 {
+		t.Fatalf("bad: %d", n)
+	}
+	nr := txn.Commit()
+
+	expect := map[string]int{
+		"svc.a.":        0,
+		"svc.a.db.host": 1,
+		"svc.a.db.port": 2,
+		"svc.a.log":     3,
+		"svc.b":         200,
+		"svc.b.":        0,
+		"svc.b.db.host": 1,
+		"svc.b.db.port": 2,
+		"svc.b.log":     3,
+		"":              0,
+		"db.host":       1,
+		"db.port":       2,
+		"log":           3,
+	}
+	if nr.Len() != len(expect) {
+		t.Fatalf("bad: %d", nr.Len())
+	}
+	for k, v := range expect {
+		if got, ok := nr.Get([]byte(k)); !ok || got != v {
+			t.Fatalf("bad: %q: %d %v", k, got, ok)
+		}
+	}
+	checkCanonical(t, nr.Root())
+	checkSizes(t, nr.Root())
+
+	// The fragment is untouched, and grafting an empty tree does nothing.
+	if frag.Len() != 4 {
+		t.Fatalf("bad: %d", frag.Len())
+	}
+	if v, _ := frag.Get([]byte("db.port")); v != 2 {
+		t.Fatalf("bad: %d", v)
+	}
+	txn = nr.Txn()
+	if n := txn.Graft([]byte("x"), New[int]()); n != 0 || txn.Commit().Len() != nr.Len() {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Original keys only survive when the keys don't change.
+	lower := func(k []byte) []byte { return bytes.ToLower(k) }
+	txn = New[int]().Txn()
+	txn.InsertNormalized([]byte("Db.Host"), 1, lower)
+	frag = txn.Commit()
+	txn = New[int]().Txn()
+	txn.Graft(nil, frag)
+	txn.Graft([]byte("svc."), frag)
+	nr = txn.Commit()
+	if k, _, _ := nr.Root().GetNormalized([]byte("db.host"), lower); string(k) != "Db.Host" {
+		t.Fatalf("bad: %q", k)
+	}
+	if k, _, _ := nr.Root().GetNormalized([]byte("svc.db.host"), lower); string(k) != "svc.db.host" {
+		t.Fatalf("bad: %q", k)
+	}
+}
+
+func TestInsertRetainsKey(t *testing.T) {
+	// Load every key out of one buffer, as a bulk load from a file might.
+	var buf []byte
+	var offs []int
+	for i := 0; i < 1000; i++ {
+		offs = append(offs, len(buf))
+		buf = append(buf, fmt.Sprintf("bulk/%03d/key%d", i%37, i)...)
+	}
+	offs = append(offs, len(buf))
+
+	txn := New[int]().Txn()
+	for i := 0; i < 1000; i++ {
+		txn.Insert(buf[offs[i]:offs[i+1]:offs[i+1]], i)
+	}
+	r := txn.Commit()
+	checkSizes(t, r.Root())
+
+	// The keys handed back are the caller's own slices, not copies.
+	n := 0
+	r.Root().Walk(func(k []byte, v int) bool {
+		if &k[0] != &buf[offs[v]] {
+			t.Fatalf("bad: %q was copied", k)
+		}
+		if string(k) != fmt.Sprintf("bulk/%03d/key%d", v%37, v) {
+			t.Fatalf("bad: %q %d", k, v)
+		}
+		n++
+		return false
+	})
+	if n != 1000 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// As long as the buffer is left alone, lookups work from fresh slices
+	// and later writes on top don't disturb it.
+	r2, _, _ := r.Delete([]byte("bulk/000/key0"))
+	r2, _, _ = r2.Insert([]byte("bulk/000/key0x"), -1)
+	for i := 0; i < 1000; i++ {
+		k := []byte(fmt.Sprintf("bulk/%03d/key%d", i%37, i))
+		if v, ok := r.Get(k); !ok || v != i {
+			t.Fatalf("bad: %q %v %v", k, v, ok)
+		}
+	}
+	if _, ok := r2.Get([]byte("bulk/000/key0")); ok {
+		t.Fatalf("bad")
+	}
+	if string(buf[offs[0]:offs[1]]) != "bulk/000/key0" {
+		t.Fatalf("buffer modified: %q", buf[offs[0]:offs[1]])
+	}
+}
+
+func TestTxnDeleteN(t *testing.T) {
+	r := New[int]()
+	for i := 0; i < 100; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("perm/%02d", i)), i)
+	}
+
+	txn := r.Txn()
+	keys := [][]byte{
+		[]byte("perm/00"),
+		[]byte("perm/50"),
+		[]byte("perm/missing"),
+		[]byte("perm/50"), // repeated
+		[]byte("perm/9"),  // only a prefix
+		[]byte("perm/99"),
+		nil,
+	}
+	removed, newLen := txn.DeleteN(keys)
+	if removed != 3 || newLen != 97 {
+		t.Fatalf("bad: %d %d", removed, newLen)
+	}
+	r2 := txn.Commit()
+	if r2.Len() != newLen {
+		t.Fatalf("bad: %d != %d", r2.Len(), newLen)
+	}
+	checkSizes(t, r2.Root())
+	for _, k := range []string{"perm/00", "perm/50", "perm/99"} {
+		if _, ok := r2.Get([]byte(k)); ok {
+			t.Fatalf("bad: %q still set", k)
+		}
+	}
+	if r.Len() != 100 {
+		t.Fatalf("bad: %d", r.Len())
+	}
+
+	// Nothing to delete.
+	txn = r2.Txn()
+	if removed, newLen := txn.DeleteN(nil); removed != 0 || newLen != 97 {
+		t.Fatalf("bad: %d %d", removed, newLen)
+	}
+}
+
+// arnKeys returns AWS ARN-style keys, which share long prefixes.
+func arnKeys(n int) [][]byte {
+	services := []string{"s3", "iam", "lambda", "dynamodb", "sqs"}
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1"}
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("arn:aws:%s:%s:%012d:resource/tenant-%d/item-%d",
+			services[i%len(services)], regions[i%len(regions)], 100000000000+i%17, i%101, i))
+	}
+	return keys
+}
+
+func BenchmarkARNUpdate(b *testing.B) {
+	keys := arnKeys(100000)
+	txn := New[int]().Txn()
+	for i, k := range keys {
+		txn.Insert(k, i)
+	}
+	r := txn.Commit()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Rewrite every value, which copies every node in the tree once.
+		txn := r.Txn()
+		for j, k := range keys {
+			txn.Insert(k, j+i)
+		}
+		txn.Commit()
+	}
+}
+
+func TestWriteNodeSharesPrefix(t *testing.T) {
+	keys := arnKeys(2000)
+	txn := New[int]().Txn()
+	for i, k := range keys {
+		txn.Insert(k, i)
+	}
+	r := txn.Commit()
+	hashV := func(v int) []byte { return []byte(strconv.Itoa(v)) }
+	before := r.Root().ContentHash(hashV)
+
+	// Update every value, split prefixes with new keys, and delete enough to
+	// merge some nodes back together.
+	txn = r.Txn()
+	for i, k := range keys {
+		txn.Insert(k, -i)
+	}
+	for i := 0; i < len(keys); i += 7 {
+		txn.Insert(keys[i][:len(keys[i])-1], i)
+		txn.Delete(keys[i])
+	}
+	txn.DeletePrefix([]byte("arn:aws:sqs:"))
+	txn.Insert([]byte("arn:aws:s3.*"), 0)
+	r2 := txn.Commit()
+	checkSizes(t, r2.Root())
+	checkCanonical(t, r2.Root())
+
+	// The original is untouched.
+	if r.Root().ContentHash(hashV) != before {
+		t.Fatalf("original changed")
+	}
+	for i, k := range keys {
+		if v, ok := r.Get(k); !ok || v != i {
+			t.Fatalf("bad: %q %v %v", k, v, ok)
+		}
+	}
+	if !r2.Root().MatchWithWildcards([]byte("arn:aws:s3.bucket")) {
+		t.Fatalf("bad")
+	}
+
+	// The copy of the root's only child still points into the same bytes.
+	a, b := r.Root().edges[0].node, r2.Root().edges[0].node
+	if a == b || &a.prefix[0] != &b.prefix[0] {
+		t.Fatalf("bad: prefix not shared")
+	}
+}
+
+func TestSameSnapshot(t *testing.T) {
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("a"), 1)
+	r, _, _ = r.Insert([]byte("b"), 2)
+
+	if !SameSnapshot(r, r) {
+		t.Fatalf("bad")
+	}
+
+	// A transaction that doesn't change anything keeps the root.
+	txn := r.Txn()
+	txn.Get([]byte("a"))
+	txn.Delete([]byte("missing"))
+	same := txn.Commit()
+	if !SameSnapshot(r, same) || !SameSnapshot(same, r) {
+		t.Fatalf("bad")
+	}
+
+	// Any change gives a new root, even one that's later undone.
+	r2, _, _ := r.Insert([]byte("a"), 1)
+	if SameSnapshot(r, r2) {
+		t.Fatalf("bad")
+	}
+	r3, _, _ := r.Insert([]byte("c"), 3)
+	r3, _, _ = r3.Delete([]byte("c"))
+	if SameSnapshot(r, r3) {
+		t.Fatalf("bad")
+	}
+
+	// Equal contents built separately aren't the same snapshot.
+	other := New[int]()
+	other, _, _ = other.Insert([]byte("a"), 1)
+	other, _, _ = other.Insert([]byte("b"), 2)
+	if SameSnapshot(r, other) {
+		t.Fatalf("bad")
+	}
+
+	if !SameSnapshot[int](nil, nil) || SameSnapshot(r, nil) || SameSnapshot(nil, r) {
+		t.Fatalf("bad")
+	}
+}
+
+func TestTxnMove(t *testing.T) {
+	build := func() *Tree[int] {
+		r := New[int]()
+		for i, k := range []string{"users/alice", "users/bob", "users/carol"} {
+			r, _, _ = r.Insert([]byte(k), i+1)
+		}
+		r, _, _ = r.InsertLiteral([]byte("users/*"), 9)
+		return r
+	}
+	closed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// Moving to a new key fires the watches for both keys.
+	r := build()
+	fromWatch, _, _ := r.Root().GetWatch([]byte("users/alice"))
+	toWatch, _, _ := r.Root().GetWatch([]byte("users/dave"))
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	if !txn.Move([]byte("users/alice"), []byte("users/dave")) {
+		t.Fatalf("bad")
+	}
+	r2 := txn.Commit()
+	if !closed(fromWatch) || !closed(toWatch) {
+		t.Fatalf("bad: watches not fired")
+	}
+	if _, ok := r2.Get([]byte("users/alice")); ok {
+		t.Fatalf("bad")
+	}
+	if v, ok := r2.Get([]byte("users/dave")); !ok || v != 1 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if r2.Len() != 4 {
+		t.Fatalf("bad: %d", r2.Len())
+	}
+	checkSizes(t, r2.Root())
+
+	// Moving over an existing key overwrites it.
+	r = build()
+	fromWatch, _, _ = r.Root().GetWatch([]byte("users/alice"))
+	toWatch, _, _ = r.Root().GetWatch([]byte("users/bob"))
+	txn = r.Txn()
+	txn.TrackMutate(true)
+	if !txn.Move([]byte("users/alice"), []byte("users/bob")) {
+		t.Fatalf("bad")
+	}
+	r2 = txn.Commit()
+	if !closed(fromWatch) || !closed(toWatch) {
+		t.Fatalf("bad: watches not fired")
+	}
+	if v, ok := r2.Get([]byte("users/bob")); !ok || v != 1 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if r2.Len() != 3 {
+		t.Fatalf("bad: %d", r2.Len())
+	}
+	checkSizes(t, r2.Root())
+
+	// Moving a key that isn't set does nothing.
+	r = build()
+	txn = r.Txn()
+	if txn.Move([]byte("users/zed"), []byte("users/eve")) {
+		t.Fatalf("bad")
+	}
+	if !SameSnapshot(r, txn.Commit()) {
+		t.Fatalf("bad: tree changed")
+	}
+
+	// A literal key stays literal.
+	r = build()
+	txn = r.Txn()
+	txn.Move([]byte("users/*"), []byte("admins.*"))
+	r2 = txn.Commit()
+	if v, ok := r2.Get([]byte("admins.*")); !ok || v != 9 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if r2.Root().MatchWithWildcards([]byte("admins.root")) {
+		t.Fatalf("bad: literal became a pattern")
+	}
+
+	// The original key of a normalized entry is only kept if the key stays
+	// the same.
+	lower := func(k []byte) []byte { return bytes.ToLower(k) }
+	txn = New[int]().Txn()
+	txn.InsertNormalized([]byte("Users/Alice"), 1, lower)
+	txn.Move([]byte("users/alice"), []byte("users/alice"))
+	if k, _, _ := txn.GetNormalized([]byte("users/alice"), lower); string(k) != "Users/Alice" {
+		t.Fatalf("bad: %q", k)
+	}
+	txn.Move([]byte("users/alice"), []byte("users/dave"))
+	if k, _, _ := txn.GetNormalized([]byte("users/dave"), lower); string(k) != "users/dave" {
+		t.Fatalf("bad: %q", k)
+	}
+}
+
+func TestTxnUpdateValues(t *testing.T) {
+	r := New[int]()
+	for i := 0; i < 1000; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("derived/%03d/%d", i%50, i)), i)
+	}
+	r, _, _ = r.InsertLiteral([]byte("derived.*"), -1)
+
+	// Nothing changing copies nothing.
+	txn := r.Txn()
+	seen := 0
+	txn.UpdateValues(func(k []byte, v int) (int, bool) {
+		seen++
+		return v, false
+	})
+	if copied, _ := txn.AllocStats(); copied != 0 {
+		t.Fatalf("bad: %d copies", copied)
+	}
+	if seen != r.Len() {
+		t.Fatalf("bad: %d", seen)
+	}
+	if !SameSnapshot(r, txn.Commit()) {
+		t.Fatalf("bad: tree changed")
+	}
+
+	// Change a couple of values, watching one changed and one unchanged key.
+	changed := []byte("derived/007/7")
+	unchanged := []byte("derived/007/57")
+	changedWatch, _, _ := r.Root().GetWatch(changed)
+	unchangedWatch, _, _ := r.Root().GetWatch(unchanged)
+
+	txn = r.Txn()
+	txn.TrackMutate(true)
+	txn.UpdateValues(func(k []byte, v int) (int, bool) {
+		switch {
+		case v == 7, v == 900:
+			return v * 10, true
+		case v == -1:
+			return -2, true
+		}
+		return v, false
+	})
+	copied, _ := txn.AllocStats()
+	r2 := txn.Commit()
+
+	// Only the paths to the three changed keys were copied, which is a
+	// handful of nodes rather than the whole tree.
+	if copied == 0 || copied > 12 {
+		t.Fatalf("bad: %d copies", copied)
+	}
+	select {
+	case <-changedWatch:
+	default:
+		t.Fatalf("bad: changed key's watch didn't fire")
+	}
+	select {
+	case <-unchangedWatch:
+		t.Fatalf("bad: unchanged key's watch fired")
+	default:
+	}
+
+	for i := 0; i < 1000; i++ {
+		want := i
+		if i == 7 || i == 900 {
+			want = i * 10
+		}
+		if v, ok := r2.Get([]byte(fmt.Sprintf("derived/%03d/%d", i%50, i))); !ok || v != want {
+			t.Fatalf("bad: %d %v %v", i, v, ok)
+		}
+	}
+	if r2.Len() != r.Len() {
+		t.Fatalf("bad: %d", r2.Len())
+	}
+	checkSizes(t, r2.Root())
+
+	// A literal key stays literal.
+	if v, _ := r2.Get([]byte("derived.*")); v != -2 || r2.Root().MatchWithWildcards([]byte("derived.x")) {
+		t.Fatalf("bad: %d", v)
+	}
+}
+
+func TestTxnRewriteKeys(t *testing.T) {
+	build := func() *Tree[int] {
+		r := New[int]()
+		for i, k := range []string{
+			"ns/Users/Alice", "ns/Users/bob", "ns/Groups/Admins", "ns/users/carol",
+			"other/Users/Dave",
+		} {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		return r
+	}
+
+	// Lowercase the second segment across the namespace.
+	lowerSegment := func(k []byte) []byte {
+		parts := strings.SplitN(string(k), "/", 3)
+		parts[1] = strings.ToLower(parts[1])
+		return []byte(strings.Join(parts, "/"))
+	}
+
+	r := build()
+	watch, _, _ := r.Root().GetWatch([]byte("ns/Users/Alice"))
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	if n := txn.RewriteKeys([]byte("ns/"), lowerSegment); n != 4 {
+		t.Fatalf("bad: %d", n)
+	}
+	r2 := txn.Commit()
+	select {
+	case <-watch:
+	default:
+		t.Fatalf("bad: watch not fired")
+	}
+	checkSizes(t, r2.Root())
+
+	var got []string
+	r2.Root().Walk(func(k []byte, v int) bool {
+		got = append(got, fmt.Sprintf("%s=%d", k, v))
+		return false
+	})
+	expect := "ns/groups/Admins=2 ns/users/Alice=0 ns/users/bob=1 ns/users/carol=3 other/Users/Dave=4"
+	if strings.Join(got, " ") != expect {
+		t.Fatalf("bad: %q", got)
+	}
+
+	// Keys that collide keep the last in key order, and keys may land
+	// outside the prefix, overwriting what's there.
+	r = build()
+	txn = r.Txn()
+	n := txn.RewriteKeys([]byte("ns/Users/"), func(k []byte) []byte {
+		return []byte("other/Users/Dave")
+	})
+	r2 = txn.Commit()
+	if n != 2 || r2.Len() != 3 {
+		t.Fatalf("bad: %d %d", n, r2.Len())
+	}
+	if v, _ := r2.Get([]byte("other/Users/Dave")); v != 1 {
+		t.Fatalf("bad: %d", v)
+	}
+
+	// Entries can swap keys.
+	r = build()
+	txn = r.Txn()
+	txn.RewriteKeys([]byte("ns/Users/"), func(k []byte) []byte {
+		if string(k) == "ns/Users/Alice" {
+			return []byte("ns/Users/bob")
+		}
+		return []byte("ns/Users/Alice")
+	})
+	r2 = txn.Commit()
+	if a, _ := r2.Get([]byte("ns/Users/Alice")); a != 1 {
+		t.Fatalf("bad: %d", a)
+	}
+	if b, _ := r2.Get([]byte("ns/Users/bob")); b != 0 {
+		t.Fatalf("bad: %d", b)
+	}
+
+	// Nothing under the prefix.
+	r = build()
+	txn = r.Txn()
+	if n := txn.RewriteKeys([]byte("missing/"), lowerSegment); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+	if !SameSnapshot(r, txn.Commit()) {
+		t.Fatalf("bad: tree changed")
+	}
+
+	// Original keys are kept for the entries whose keys don't change.
+	lower := func(k []byte) []byte { return bytes.ToLower(k) }
+	txn = New[int]().Txn()
+	txn.InsertNormalized([]byte("Tenant.ABC"), 1, lower)
+	txn.InsertNormalized([]byte("Tenant.DEF"), 2, lower)
+	txn.RewriteKeys([]byte("tenant."), func(k []byte) []byte {
+		if string(k) == "tenant.def" {
+			return []byte("tenant.xyz")
+		}
+		return k
+	})
+	r2 = txn.Commit()
+	var origs []string
+	for k := range r2.Root().IterateOriginal(nil) {
+		origs = append(origs, string(k))
+	}
+	if !reflect.DeepEqual(origs, []string{"Tenant.ABC", "tenant.xyz"}) {
+		t.Fatalf("bad: %v", origs)
+	}
+}
+
+func TestSharedNodeCount(t *testing.T) {
+	var nodes func(n *Node[int]) int
+	nodes = func(n *Node[int]) int {
+		c := 1
+		for _, e := range n.edges {
+			c += nodes(e.node)
+		}
+		return c
+	}
+
+	txn := New[int]().Txn()
+	for i := 0; i < 1000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%03d/%d", i%37, i)), i)
+	}
+	r := txn.Commit()
+	total := nodes(r.Root())
+	if n := SharedNodeCount(r, r); n != total {
+		t.Fatalf("bad: %d != %d", n, total)
+	}
+
+	// Inserting one key only copies the nodes on its path.
+	r2, _, _ := r.Insert([]byte("key/012/new"), -1)
+	shared := SharedNodeCount(r, r2)
+	if shared == total || total-shared > 5 {
+		t.Fatalf("bad: %d of %d shared", shared, total)
+	}
+	if n := SharedNodeCount(r2, r); n != shared {
+		t.Fatalf("bad: %d != %d", n, shared)
+	}
+
+	// Trees built separately share nothing, even when they're the same or
+	// empty.
+	copied, err := FromSlices(keysOf(r), make([]int, r.Len()))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n := SharedNodeCount(r, copied); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := SharedNodeCount(New[int](), New[int]()); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+// keysOf returns the keys of the tree in order.
+func keysOf[T any](r *Tree[T]) [][]byte {
+	var keys [][]byte
+	r.Root().Walk(func(k []byte, _ T) bool {
+		keys = append(keys, k)
+		return false
+	})
+	return keys
+}
@@ -12,6 +12,12 @@ import (
 type Iterator[T any] struct {
 	node  *Node[T]
 	stack []edges[T]
+
+	// cursor is the last key returned by Next, or the position given to
+	// Resume. It's only valid if hasCursor is set, since the empty key is
+	// a valid cursor.
+	cursor    []byte
+	hasCursor bool
 }
 
 // SeekPrefixWatch is used to seek the iterator to a given prefix
@@ -19,6 +25,7 @@ type Iterator[T any] struct {
 func (i *Iterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
 	// Wipe the stack
 	i.stack = nil
+	i.cursor, i.hasCursor = nil, false
 	n := i.node
 	watch = n.mutateCh
 	search := prefix
@@ -87,6 +94,7 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 	// children that we don't traverse on the way to the reverse lower bound as it
 	// walks the stack.
 	i.stack = []edges[T]{}
+	i.cursor, i.hasCursor = nil, false
 	// i.node starts off in the common case as pointing to the root node of the
 	// tree. By the time we return we have either found a lower bound and setup
 	// the stack to traverse all larger keys, or we have not and the stack and
@@ -173,7 +181,10 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 	}
 }
 
-// Next returns the next node in order
+// Next returns the next node in order. The returned key is the same slice
+// that was given to Insert for that entry; it is never reused or modified by
+// the iterator or by later transactions, so it is safe to retain for as long
+// as the caller does not modify the slice it originally inserted.
 func (i *Iterator[T]) Next() ([]byte, T, bool) {
 	var zero T
 	// Initialize our stack if needed
@@ -201,8 +212,78 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 
 		// Return the leaf values if any
 		if elem.leaf != nil {
+			i.cursor, i.hasCursor = elem.leaf.key, true
 			return elem.leaf.key, elem.leaf.val, true
 		}
 	}
 	return nil, zero, false
 }
+
+// Clone returns a copy of the iterator at its current position. The two then
+// advance independently of each other, so the clone can be used to look ahead
+// without losing the original's place. Only the iterator's stack is copied,
+// not any of the tree.
+func (i *Iterator[T]) Clone() *Iterator[T] {
+	c := *i
+	if i.stack != nil {
+		c.stack = make([]edges[T], len(i.stack))
+		copy(c.stack, i.stack)
+	}
+	return &c
+}
+
+// Remaining returns the number of entries the iterator has yet to return,
+// under the prefix it was seeked to, or in the whole tree if it wasn't. This
+// uses the sizes that every node keeps for its subtree, so it only costs as
+// much as looking at the iterator's pending edges without visiting any of the
+// entries. It returns zero once the iterator is exhausted.
+func (i *Iterator[T]) Remaining() int {
+	if i.stack == nil {
+		if i.node == nil {
+			return 0
+		}
+		return i.node.size
+	}
+
+	remaining := 0
+	for _, es := range i.stack {
+		for _, e := range es {
+			remaining += e.node.size
+		}
+	}
+	return remaining
+}
+
+// Cursor returns the position of the iterator as the last key returned by
+// Next, which can later be given to Resume on a new iterator to continue
+// strictly after it. A nil cursor means that the iterator hasn't returned
+// anything yet; a cursor for the empty key is returned as a non-nil empty
+// slice so the two can be told apart. The cursor is just a key, so it can be
+// stored or sent elsewhere and used against a later version of the tree.
+func (i *Iterator[T]) Cursor() []byte {
+	if !i.hasCursor {
+		return nil
+	}
+	if i.cursor == nil {
+		return []byte{}
+	}
+	return i.cursor
+}
+
+// Resume is used to seek the iterator to the smallest key that is strictly
+// greater than the given cursor, as returned by Cursor. A nil cursor leaves
+// the iterator to start from the beginning. Like SeekLowerBound this must be
+// called on an iterator for the root of a tree, before calling Next. The
+// cursor doesn't need to still be present in the tree.
+func (i *Iterator[T]) Resume(cursor []byte) {
+	if cursor == nil {
+		return
+	}
+
+	// The smallest key strictly greater than the cursor is the cursor with
+	// a zero byte appended.
+	after := make([]byte, len(cursor)+1)
+	copy(after, cursor)
+	i.SeekLowerBound(after)
+	i.cursor, i.hasCursor = after[:len(cursor)], true
+}
@@ -0,0 +1,99 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"container/heap"
+)
+
+// MultiIterator yields the entries from several iterators merged into a
+// single sorted sequence, such as for a scan across trees that each hold a
+// shard of the keys. When the same key comes from more than one iterator, the
+// entry from the earliest of them in the list given to MergeIterators wins,
+// and the others are skipped.
+type MultiIterator[T any] struct {
+	fronts mergeHeap[T]
+}
+
+// MergeIterators returns an iterator over the merged entries of the given
+// iterators, which may be seeked beforehand but must not have been advanced
+// by Next. The merge takes them over, so they must not be used directly
+// afterwards. Each call to Next costs O(log n) in the number of iterators.
+func MergeIterators[T any](iters ...*Iterator[T]) *MultiIterator[T] {
+	m := &MultiIterator[T]{}
+	for i, it := range iters {
+		m.fronts.push(mergeFront[T]{iter: it, index: i})
+	}
+	heap.Init(&m.fronts)
+	return m
+}
+
+// Next returns the next entry in key order across all of the iterators.
+func (m *MultiIterator[T]) Next() ([]byte, T, bool) {
+	if len(m.fronts) == 0 {
+		var zero T
+		return nil, zero, false
+	}
+	top := m.fronts[0]
+	m.advance()
+
+	// Skip the same key from any later iterators.
+	for len(m.fronts) > 0 && bytes.Equal(m.fronts[0].key, top.key) {
+		m.advance()
+	}
+	return top.key, top.val, true
+}
+
+// advance moves the iterator at the top of the heap on to its next entry.
+func (m *MultiIterator[T]) advance() {
+	f := &m.fronts[0]
+	var ok bool
+	if f.key, f.val, ok = f.iter.Next(); ok {
+		heap.Fix(&m.fronts, 0)
+	} else {
+		heap.Pop(&m.fronts)
+	}
+}
+
+// mergeFront is the next entry from one of the merged iterators.
+type mergeFront[T any] struct {
+	iter  *Iterator[T]
+	index int
+	key   []byte
+	val   T
+}
+
+// mergeHeap is a min-heap of the merged iterators ordered by their next key,
+// and then by their position in the list so that the earliest one wins.
+type mergeHeap[T any] []mergeFront[T]
+
+// push adds the iterator to the heap if it has any entries, without fixing up
+// the heap.
+func (h *mergeHeap[T]) push(f mergeFront[T]) {
+	var ok bool
+	if f.key, f.val, ok = f.iter.Next(); ok {
+		*h = append(*h, f)
+	}
+}
+
+func (h mergeHeap[T]) Len() int { return len(h) }
+
+func (h mergeHeap[T]) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].key, h[j].key); c != 0 {
+		return c < 0
+	}
+	return h[i].index < h[j].index
+}
+
+func (h mergeHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap[T]) Push(x any) { *h = append(*h, x.(mergeFront[T])) }
+
+func (h *mergeHeap[T]) Pop() any {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
@@ -0,0 +1,131 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMergeIterators(t *testing.T) {
+	build := func(keys ...string) *Tree[string] {
+		r := New[string]()
+		for _, k := range keys {
+			r, _, _ = r.Insert([]byte(k), k)
+		}
+		return r
+	}
+	shards := []*Tree[string]{
+		build("a", "d", "g", "shared"),
+		build("", "b", "e", "shared", "z"),
+		build("c", "f", "shared"),
+	}
+	// Tag the values so we can tell which shard won.
+	for i, s := range shards {
+		shards[i], _, _ = s.Insert([]byte("shared"), string(rune('0'+i)))
+	}
+
+	var iters []*Iterator[string]
+	for _, s := range shards {
+		iters = append(iters, s.Root().Iterator())
+	}
+	m := MergeIterators(iters...)
+	var keys []string
+	for k, v, ok := m.Next(); ok; k, v, ok = m.Next() {
+		if string(k) == "shared" && v != "0" {
+			t.Fatalf("bad: %q", v)
+		}
+		keys = append(keys, string(k))
+	}
+	expect := []string{"", "a", "b", "c", "d", "e", "f", "g", "shared", "z"}
+	if !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("bad: %q", keys)
+	}
+	if _, _, ok := m.Next(); ok {
+		t.Fatalf("expected the iterator to stay exhausted")
+	}
+
+	// The earliest iterator in the list wins, whichever shard it's from.
+	m = MergeIterators(shards[2].Root().Iterator(), shards[0].Root().Iterator())
+	for k, v, ok := m.Next(); ok; k, v, ok = m.Next() {
+		if string(k) == "shared" && v != "2" {
+			t.Fatalf("bad: %q", v)
+		}
+	}
+
+	// Seeked iterators are merged from where they are.
+	a, b := shards[0].Root().Iterator(), shards[1].Root().Iterator()
+	a.SeekLowerBound([]byte("e"))
+	b.SeekPrefix([]byte("s"))
+	m = MergeIterators(a, b)
+	keys = nil
+	for k, _, ok := m.Next(); ok; k, _, ok = m.Next() {
+		keys = append(keys, string(k))
+	}
+	if !reflect.DeepEqual(keys, []string{"g", "shared"}) {
+		t.Fatalf("bad: %q", keys)
+	}
+
+	// Nothing to merge.
+	if _, _, ok := MergeIterators[string]().Next(); ok {
+		t.Fatalf("expected no entries")
+	}
+	if _, _, ok := MergeIterators(New[string]().Root().Iterator()).Next(); ok {
+		t.Fatalf("expected no entries")
+	}
+}
+
+func TestMergeIterators_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "abc"
+		b := make([]byte, rnd.Intn(5))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 100; round++ {
+		first := make(map[string]int)
+		var iters []*Iterator[int]
+		for s := 0; s < rnd.Intn(5); s++ {
+			r := New[int]()
+			for i := 0; i < rnd.Intn(20); i++ {
+				k := randKey()
+				r, _, _ = r.Insert(k, s)
+				if _, ok := first[string(k)]; !ok {
+					first[string(k)] = s
+				}
+			}
+			iters = append(iters, r.Root().Iterator())
+		}
+
+		var expect []string
+		for k := range first {
+			expect = append(expect, k)
+		}
+		sort.Strings(expect)
+
+		var got []string
+		var last []byte
+		m := MergeIterators(iters...)
+		for k, v, ok := m.Next(); ok; k, v, ok = m.Next() {
+			if got != nil && bytes.Compare(last, k) >= 0 {
+				t.Fatalf("out of order: %q after %q", k, last)
+			}
+			if v != first[string(k)] {
+				t.Fatalf("bad: %q from shard %d, expected %d", k, v, first[string(k)])
+			}
+			got = append(got, string(k))
+			last = k
+		}
+		if len(got) != len(expect) || (len(got) > 0 && !reflect.DeepEqual(got, expect)) {
+			t.Fatalf("bad: %q, expected %q", got, expect)
+		}
+	}
+}
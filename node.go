@@ -5,6 +5,9 @@ package iradix
 
 import (
 	"bytes"
+	"fmt"
+	"iter"
+	"math/rand"
 	"sort"
 )
 
@@ -18,6 +21,24 @@ type leafNode[T any] struct {
 	mutateCh chan struct{}
 	key      []byte
 	val      T
+
+	// literal is set if the key was inserted as literal data, which the
+	// wildcard matchers must never treat as a pattern.
+	literal bool
+
+	// orig points to the key as given to InsertNormalized, before it was
+	// normalized into key, or is nil if the key was inserted as is. It's a
+	// pointer so that the leaves without one only pay for the pointer.
+	orig *[]byte
+}
+
+// origKey returns the key the leaf was inserted with, which is the original
+// key for an entry inserted by InsertNormalized and just the key otherwise.
+func (l *leafNode[T]) origKey() []byte {
+	if l.orig != nil {
+		return *l.orig
+	}
+	return l.key
 }
 
 // edge is used to represent an edge node
@@ -41,12 +62,63 @@ type Node[T any] struct {
 	// We avoid a fully materialized slice to save memory,
 	// since in most cases we expect to be sparse
 	edges edges[T]
+
+	// size is the number of leaves in this node's subtree, including its own
+	// leaf if it has one.
+	size int
+
+	// wild records whether the tree holds the universal wildcard, so that
+	// MatchWithWildcards can skip looking it up. It's only set for the root
+	// of a tree when a transaction is committed, and it isn't carried over
+	// when a node is copied, so it's never stale.
+	wild wildcardFlag
 }
 
 func (n *Node[T]) isLeaf() bool {
 	return n.leaf != nil
 }
 
+// IsLeaf returns true if a key ends at this node, so that it holds a value.
+func (n *Node[T]) IsLeaf() bool {
+	return n.isLeaf()
+}
+
+// Prefix returns the part of the key that this node adds to the path from its
+// parent. The full key of a leaf is given by LeafKey instead. The returned
+// slice is shared with the tree, so it must not be modified.
+func (n *Node[T]) Prefix() []byte {
+	return n.prefix
+}
+
+// LeafKey returns the full key of the entry held by this node, or nil if it
+// isn't a leaf. The returned key is the stored key, so it must not be
+// modified.
+func (n *Node[T]) LeafKey() []byte {
+	if n.leaf == nil {
+		return nil
+	}
+	return n.leaf.key
+}
+
+// LeafValue returns the value of the entry held by this node, and false if it
+// isn't a leaf.
+func (n *Node[T]) LeafValue() (T, bool) {
+	if n.leaf == nil {
+		var zero T
+		return zero, false
+	}
+	return n.leaf.val, true
+}
+
+// LeafWatch returns the watch channel for the entry held by this node, which
+// is the same channel GetWatch returns for its key, or nil if it isn't a leaf.
+func (n *Node[T]) LeafWatch() <-chan struct{} {
+	if n.leaf == nil {
+		return nil
+	}
+	return n.leaf.mutateCh
+}
+
 func (n *Node[T]) addEdge(e edge[T]) {
 	num := len(n.edges)
 	idx := sort.Search(num, func(i int) bool {
@@ -103,9 +175,21 @@ func (n *Node[T]) delEdge(label byte) {
 		copy(n.edges[idx:], n.edges[idx+1:])
 		n.edges[len(n.edges)-1] = edge[T]{}
 		n.edges = n.edges[:len(n.edges)-1]
+		if len(n.edges) == 0 {
+			// Don't hold on to the old backing array.
+			n.edges = nil
+		}
 	}
 }
 
+// GetWatch is used to lookup a specific key, returning the watch channel,
+// value and if it was found. If the key is present the channel belongs to its
+// leaf, so it's closed only when that key's value is replaced or the key is
+// deleted, and writes to other keys don't affect it. If the key is absent the
+// channel belongs to the deepest node on the path to where the key would be,
+// which is closed when the key is inserted, but may also be closed by writes
+// to other keys under that node. Channels are only closed by transactions
+// with TrackMutate enabled.
 func (n *Node[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
 	search := k
 	watch := n.mutateCh
@@ -138,11 +222,127 @@ func (n *Node[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
 	return watch, zero, false
 }
 
+// getLeaf is used to lookup the leaf for a specific key, returning nil if
+// it isn't set.
+func (n *Node[T]) getLeaf(k []byte) *leafNode[T] {
+	search := k
+	for {
+		// Check for key exhaustion
+		if len(search) == 0 {
+			return n.leaf
+		}
+
+		// Look for an edge
+		_, n = n.getEdge(search[0])
+		if n == nil {
+			return nil
+		}
+
+		// Consume the search prefix
+		if !bytes.HasPrefix(search, n.prefix) {
+			return nil
+		}
+		search = search[len(n.prefix):]
+	}
+}
+
 func (n *Node[T]) Get(k []byte) (T, bool) {
 	_, val, ok := n.GetWatch(k)
 	return val, ok
 }
 
+// GetNormalized is like Get, but looks up norm(k) and also returns the
+// original key the entry was inserted with by InsertNormalized. For an entry
+// that was inserted normally, the original key is just its key.
+func (n *Node[T]) GetNormalized(k []byte, norm func([]byte) []byte) ([]byte, T, bool) {
+	leaf := n.getLeaf(norm(k))
+	if leaf == nil {
+		var zero T
+		return nil, zero, false
+	}
+	return leaf.origKey(), leaf.val, true
+}
+
+// Contains returns true if the given key is present in the tree, exactly. It's
+// the same as checking the bool returned by Get. Note that LongestPrefix isn't
+// a membership test: it succeeds for any key that has some stored key as a
+// prefix, so with just "foo" stored it succeeds for "foobar" too.
+func (n *Node[T]) Contains(k []byte) bool {
+	_, ok := n.Get(k)
+	return ok
+}
+
+// ContainsPrefix returns true if any key in the tree starts with the given
+// prefix, including the prefix itself. This is the opposite direction to
+// LongestPrefix, which looks for a stored key that is a prefix of its
+// argument. Every key contains the empty prefix, so that only fails for an
+// empty tree.
+func (n *Node[T]) ContainsPrefix(prefix []byte) bool {
+	pn := n.prefixNode(prefix)
+	return pn != nil && pn.size > 0
+}
+
+// LenPrefix returns the number of keys that start with the given prefix,
+// including the prefix itself, or 0 if there are none. Since every node keeps
+// the size of its subtree this only costs a lookup of the prefix.
+func (n *Node[T]) LenPrefix(prefix []byte) int {
+	if pn := n.prefixNode(prefix); pn != nil {
+		return pn.size
+	}
+	return 0
+}
+
+// ValuesPrefix returns the values of all the keys that start with the given
+// prefix, in key order, or an empty slice if there are none. The result is
+// allocated once at the right size using the cached subtree size.
+func (n *Node[T]) ValuesPrefix(prefix []byte) []T {
+	pn := n.prefixNode(prefix)
+	if pn == nil {
+		return []T{}
+	}
+	return appendValues(make([]T, 0, pn.size), pn)
+}
+
+// appendValues appends the values in the subtree under n to out, in key order.
+func appendValues[T any](out []T, n *Node[T]) []T {
+	if n.leaf != nil {
+		out = append(out, n.leaf.val)
+	}
+	for _, e := range n.edges {
+		out = appendValues(out, e.node)
+	}
+	return out
+}
+
+// prefixNode returns the node whose subtree holds exactly the keys that start
+// with the given prefix, or nil if there are no such keys. The returned node's
+// path may extend past the prefix if the prefix ends part way along an edge.
+func (n *Node[T]) prefixNode(prefix []byte) *Node[T] {
+	search := prefix
+	for {
+		// Check for key exhaustion
+		if len(search) == 0 {
+			return n
+		}
+
+		// Look for an edge
+		_, n = n.getEdge(search[0])
+		if n == nil {
+			return nil
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(search, n.prefix) {
+			search = search[len(n.prefix):]
+		} else if bytes.HasPrefix(n.prefix, search) {
+			// Child may be under our search prefix
+			return n
+		} else {
+			return nil
+		}
+	}
+}
+
 // LongestPrefix is like Get, but instead of an
 // exact match, it will return the longest prefix match.
 func (n *Node[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
@@ -179,6 +379,94 @@ func (n *Node[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
 	return nil, zero, false
 }
 
+// LongestSegmentPrefix is like LongestPrefix, but only matches a stored key
+// that ends on a segment boundary of the given key, so the key must either
+// end there too or carry on with sep. For example with "tenant" and
+// "tenant.abc" stored, "tenant.abc123" matches "tenant" but not "tenant.abc",
+// which ends partway through a segment. The same rule applies to every stored
+// key, so the empty key only matches an empty key or one starting with sep,
+// and "tenant." only matches a longer key if it carries on with another sep.
+func (n *Node[T]) LongestSegmentPrefix(k []byte, sep byte) ([]byte, T, bool) {
+	var last *leafNode[T]
+	search := k
+	for {
+		// Look for a leaf node that ends at a boundary
+		if n.isLeaf() && (len(search) == 0 || search[0] == sep) {
+			last = n.leaf
+		}
+
+		// Check for key exhaustion
+		if len(search) == 0 {
+			break
+		}
+
+		// Look for an edge
+		_, n = n.getEdge(search[0])
+		if n == nil {
+			break
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(search, n.prefix) {
+			search = search[len(n.prefix):]
+		} else {
+			break
+		}
+	}
+	if last != nil {
+		return last.key, last.val, true
+	}
+	var zero T
+	return nil, zero, false
+}
+
+// Nearest returns the stored key that shares the longest common prefix with
+// k, along with its value. Unlike LongestPrefix, the stored key doesn't have
+// to be a prefix of k, so this finds the closest key even when it diverges
+// from k partway through. When several keys share an equally long prefix with
+// k, the lexicographically smallest of them is returned, so an exact match
+// always wins. It only fails for an empty tree.
+func (n *Node[T]) Nearest(k []byte) ([]byte, T, bool) {
+	search := k
+	for len(search) > 0 {
+		// Every key under n shares all of the consumed part with k, so if
+		// there's no edge to follow they're all equally close.
+		_, child := n.getEdge(search[0])
+		if child == nil {
+			break
+		}
+
+		// If k diverges within the child's prefix, the keys under the child
+		// still share more with k than any other key does.
+		n = child
+		if !bytes.HasPrefix(search, n.prefix) {
+			break
+		}
+		search = search[len(n.prefix):]
+	}
+	return n.Minimum()
+}
+
+// Prune returns a new tree holding just the entries whose keys start with the
+// given prefix, with the prefix removed from each key, so the key equal to the
+// prefix becomes the empty key. This is the inverse of Txn.Graft. The prefix
+// doesn't need to end on a node boundary, and if no keys start with it the
+// tree is empty. Every leaf stores its own full key, so the entries are
+// inserted afresh under their new keys rather than re-rooting the subtree;
+// keys inserted with InsertLiteral stay literal, but like Txn.Graft, the
+// original keys from InsertNormalized are dropped unless the prefix is empty.
+func (n *Node[T]) Prune(prefix []byte) *Tree[T] {
+	pn := n.prefixNode(prefix)
+	if pn == nil {
+		return New[T]()
+	}
+	txn := New[T]().TxnWithCapacity(pn.size)
+	walkLeaves(pn, func(leaf *leafNode[T]) {
+		txn.reinsertLeaf(leaf.key[len(prefix):], leaf)
+	})
+	return txn.Commit()
+}
+
 // Minimum is used to return the minimum value in the tree
 func (n *Node[T]) Minimum() ([]byte, T, bool) {
 	for {
@@ -218,6 +506,53 @@ func (n *Node[T]) Iterator() *Iterator[T] {
 	return &Iterator[T]{node: n}
 }
 
+// PrefixIteratorAt returns an iterator over the keys under the given prefix
+// that sort strictly after the key after, so a scan of a prefix can pick up
+// from the last key it returned, as given by the iterator's Cursor. An empty
+// after starts at the beginning of the prefix, and so does one that sorts
+// before every key under the prefix. The key after doesn't need to still be
+// in the tree. The iterator never yields keys outside the prefix. Like
+// SeekLowerBound, this must be called on the root of a tree.
+func (n *Node[T]) PrefixIteratorAt(prefix, after []byte) *Iterator[T] {
+	i := n.Iterator()
+	if len(after) == 0 || bytes.Compare(after, prefix) < 0 {
+		i.SeekPrefix(prefix)
+		return i
+	}
+	if !bytes.HasPrefix(after, prefix) {
+		// The key after sorts past everything under the prefix.
+		return &Iterator[T]{}
+	}
+
+	// Seeking from the root leaves edges on the stack for every key after
+	// the cursor, so the ones pushed on the way down to the prefix, which
+	// are all outside of it, have to be dropped. Count them by taking the
+	// same path.
+	outside := 0
+	search := prefix
+	for len(search) > 0 {
+		idx, child := n.getEdge(search[0])
+		if child == nil {
+			return &Iterator[T]{}
+		}
+		if idx+1 < len(n.edges) {
+			outside++
+		}
+		if bytes.HasPrefix(search, child.prefix) {
+			search = search[len(child.prefix):]
+		} else if bytes.HasPrefix(child.prefix, search) {
+			break
+		} else {
+			return &Iterator[T]{}
+		}
+		n = child
+	}
+
+	i.Resume(after)
+	i.stack = i.stack[outside:]
+	return i
+}
+
 // ReverseIterator is used to return an iterator at
 // the given node to walk the tree backwards
 func (n *Node[T]) ReverseIterator() *ReverseIterator[T] {
@@ -243,6 +578,18 @@ func (n *Node[T]) Walk(fn WalkFn[T]) {
 	recursiveWalk(n, fn)
 }
 
+// WalkIndexed is like Walk, but also passes the callback the 0-based position
+// of each entry in key order. As with Walk, the callback returns true to stop
+// the walk.
+func (n *Node[T]) WalkIndexed(fn func(i int, k []byte, v T) bool) {
+	i := 0
+	recursiveWalk(n, func(k []byte, v T) bool {
+		stop := fn(i, k, v)
+		i++
+		return stop
+	})
+}
+
 // WalkBackwards is used to walk the tree in reverse order
 func (n *Node[T]) WalkBackwards(fn WalkFn[T]) {
 	reverseRecursiveWalk(n, fn)
@@ -278,6 +625,361 @@ func (n *Node[T]) WalkPrefix(prefix []byte, fn WalkFn[T]) {
 	}
 }
 
+// WalkDepth is like WalkPrefix, but only visits keys whose remainder after the
+// prefix has at most maxDepth dot-separated segments, counting only non-empty
+// segments. So with the prefix "a." and a maxDepth of 1, "a.b" is visited but
+// "a.b.c" is not; a key exactly at the limit is included, and a key equal to
+// the prefix is at depth zero. Subtrees that are already too deep are skipped
+// without being visited. Returns true if fn stopped the walk early.
+func (n *Node[T]) WalkDepth(prefix []byte, maxDepth int, fn WalkFn[T]) bool {
+	search := prefix
+	for {
+		// Check for key exhaustion
+		if len(search) == 0 {
+			return walkDepth(n, nil, 0, false, maxDepth, fn)
+		}
+
+		// Look for an edge
+		_, n = n.getEdge(search[0])
+		if n == nil {
+			return false
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(search, n.prefix) {
+			search = search[len(n.prefix):]
+		} else if bytes.HasPrefix(n.prefix, search) {
+			// Child may be under our search prefix, with the rest of its
+			// prefix below it
+			return walkDepth(n, n.prefix[len(search):], 0, false, maxDepth, fn)
+		} else {
+			return false
+		}
+	}
+}
+
+// walkDepth does the work for WalkDepth. The path below the prefix continues
+// with the given bytes before reaching n's leaf and edges, having so far seen
+// segs segments, and inSeg is set if the last byte was part of a segment.
+func walkDepth[T any](n *Node[T], path []byte, segs int, inSeg bool, maxDepth int, fn WalkFn[T]) bool {
+	for _, c := range path {
+		if c == '.' {
+			inSeg = false
+			continue
+		}
+		if !inSeg {
+			inSeg = true
+			segs++
+		}
+	}
+	if segs > maxDepth {
+		return false
+	}
+
+	if n.leaf != nil && fn(n.leaf.key, n.leaf.val) {
+		return true
+	}
+	for _, e := range n.edges {
+		if walkDepth(e.node, e.node.prefix, segs, inSeg, maxDepth, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChildSegmentCount returns the number of distinct segments, delimited by sep,
+// that appear immediately under the given prefix. For example with the keys
+// "tenant.a.x", "tenant.a.y" and "tenant.b", there are two segments under
+// "tenant.", namely "a" and "b". If the prefix doesn't end with sep then the
+// keys must continue with it to be counted, so under "tenant" the keys above
+// also give two segments, but "tenantx" isn't counted. A key equal to the
+// prefix isn't a child of it, so it doesn't count. Only the nodes along the
+// segments themselves are visited, not the whole subtree below them.
+func (n *Node[T]) ChildSegmentCount(prefix []byte, sep byte) int {
+	needSep := len(prefix) > 0 && prefix[len(prefix)-1] != sep
+	search := prefix
+	for {
+		// Check for key exhaustion
+		if len(search) == 0 {
+			return childSegments(n, nil, sep, false, needSep)
+		}
+
+		// Look for an edge
+		_, n = n.getEdge(search[0])
+		if n == nil {
+			return 0
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(search, n.prefix) {
+			search = search[len(n.prefix):]
+		} else if bytes.HasPrefix(n.prefix, search) {
+			// Child may be under our search prefix, with the rest of its
+			// prefix below it
+			return childSegments(n, n.prefix[len(search):], sep, false, needSep)
+		} else {
+			return 0
+		}
+	}
+}
+
+// childSegments does the work for ChildSegmentCount. The path below the prefix
+// continues with the given bytes before reaching n's leaf and edges. If started
+// is set then some of the current segment has already been seen, and if
+// needSep is set then the next byte must be a separator before the segment
+// starts.
+func childSegments[T any](n *Node[T], path []byte, sep byte, started, needSep bool) int {
+	for _, c := range path {
+		if needSep {
+			if c != sep {
+				return 0
+			}
+			needSep = false
+			continue
+		}
+		if c == sep {
+			// Everything below here is in the same segment.
+			return 1
+		}
+		started = true
+	}
+
+	// A segment ends here if there's a key for it, or if a child starts
+	// with the separator, but it must only be counted once. Any other
+	// children carry on to longer segments.
+	count := 0
+	ends := n.leaf != nil && started
+	for _, e := range n.edges {
+		if !needSep && e.label == sep {
+			ends = true
+			continue
+		}
+		count += childSegments(e.node, e.node.prefix, sep, started, needSep)
+	}
+	if ends {
+		count++
+	}
+	return count
+}
+
+// PrefixHistogram returns the number of keys under each distinct prefix made of
+// the first depth segments of the keys, delimited by sep, not including the
+// separator that follows. For example at depth 1 over the keys "t1.a", "t1.b"
+// and "t2.a" it returns {"t1": 2, "t2": 1}. A key with depth segments or fewer
+// is counted under the whole key, so "t1" would be counted along with "t1.a".
+// A depth of zero or less counts every key under the empty prefix. This is a
+// single walk that stops descending at the separator ending the last segment,
+// taking the count for the rest of the subtree from the cached sizes.
+func (n *Node[T]) PrefixHistogram(depth int, sep byte) map[string]int {
+	hist := make(map[string]int)
+	if n.size == 0 {
+		return hist
+	}
+	if depth <= 0 {
+		hist[""] = n.size
+		return hist
+	}
+	prefixHistogram(n, nil, 0, depth, sep, hist)
+	return hist
+}
+
+// prefixHistogram does the work for PrefixHistogram, where path is the path
+// down to n, not including n's own prefix, which holds segs separators.
+func prefixHistogram[T any](n *Node[T], path []byte, segs, depth int, sep byte, hist map[string]int) {
+	for i, c := range n.prefix {
+		if c != sep {
+			continue
+		}
+		if segs++; segs == depth {
+			// Everything below here is under the same prefix.
+			hist[string(append(path, n.prefix[:i]...))] += n.size
+			return
+		}
+	}
+	path = append(path, n.prefix...)
+	if n.leaf != nil {
+		hist[string(path)]++
+	}
+	for _, e := range n.edges {
+		prefixHistogram(e.node, path, segs, depth, sep, hist)
+	}
+}
+
+// KeysWithSuffix returns all the keys in the tree that end with the given
+// suffix, in sorted order. The tree only indexes prefixes, so this has to scan
+// every key and costs O(n) in the size of the tree; for frequent suffix
+// queries keep a second tree of reversed keys and use a prefix walk on that
+// instead. Every key ends with the empty suffix, and keys shorter than the
+// suffix never match. The returned keys are the stored keys, not copies.
+func (n *Node[T]) KeysWithSuffix(suffix []byte) [][]byte {
+	var out [][]byte
+	n.Walk(func(k []byte, _ T) bool {
+		if bytes.HasSuffix(k, suffix) {
+			out = append(out, k)
+		}
+		return false
+	})
+	return out
+}
+
+// IteratePrefixTrimmed returns an iterator over the entries under a prefix, in
+// key order, yielding each key with the prefix removed. A key equal to the
+// prefix is yielded as an empty key. The prefix is trimmed as raw bytes, so it
+// doesn't need to end on a segment boundary. Only the subtree under the prefix
+// is visited. The yielded keys are sub-slices of the stored keys.
+func (n *Node[T]) IteratePrefixTrimmed(prefix []byte) iter.Seq2[[]byte, T] {
+	return func(yield func([]byte, T) bool) {
+		pn := n.prefixNode(prefix)
+		if pn == nil {
+			return
+		}
+		it := pn.Iterator()
+		for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+			if !yield(k[len(prefix):], v) {
+				return
+			}
+		}
+	}
+}
+
+// Range returns an iterator over the entries with keys between lo and hi, in
+// key order. Each bound is included or excluded according to loInclusive and
+// hiInclusive, and a nil bound leaves that side unbounded, so an empty but
+// non-nil lo still excludes the empty key if loInclusive is false. If lo is
+// greater than hi, or they're equal and either end is exclusive, the range is
+// empty. Like SeekLowerBound this should be called on the root of a tree.
+func (n *Node[T]) Range(lo, hi []byte, loInclusive, hiInclusive bool) iter.Seq2[[]byte, T] {
+	return func(yield func([]byte, T) bool) {
+		it := n.Iterator()
+		if lo != nil {
+			if loInclusive {
+				it.SeekLowerBound(lo)
+			} else {
+				it.Resume(lo)
+			}
+		}
+		for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+			if hi != nil {
+				if c := bytes.Compare(k, hi); c > 0 || (c == 0 && !hiInclusive) {
+					return
+				}
+			}
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// LeafNodes returns an iterator over the nodes holding the entries under the
+// given prefix, in key order, for callers that need more than the keys and
+// values, such as each entry's watch channel. Like the rest of the tree the
+// nodes are immutable snapshots: a later transaction creates new nodes rather
+// than changing these, so they keep describing the tree they came from.
+func (n *Node[T]) LeafNodes(prefix []byte) iter.Seq[*Node[T]] {
+	return func(yield func(*Node[T]) bool) {
+		if pn := n.prefixNode(prefix); pn != nil {
+			yieldLeafNodes(pn, yield)
+		}
+	}
+}
+
+// yieldLeafNodes does the work for LeafNodes. Returns false if yield stopped
+// the walk.
+func yieldLeafNodes[T any](n *Node[T], yield func(*Node[T]) bool) bool {
+	if n.leaf != nil && !yield(n) {
+		return false
+	}
+	for _, e := range n.edges {
+		if !yieldLeafNodes(e.node, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// IterateOriginal returns an iterator over the entries under the given prefix,
+// in key order, like LeafNodes, but yielding the original key that each entry
+// was inserted with by InsertNormalized, as GetNormalized returns it. Entries
+// that were inserted normally are yielded with their key. The prefix and the
+// order are both in terms of the normalized keys, so the original keys may not
+// share the prefix or be sorted.
+func (n *Node[T]) IterateOriginal(prefix []byte) iter.Seq2[[]byte, T] {
+	return func(yield func([]byte, T) bool) {
+		for ln := range n.LeafNodes(prefix) {
+			if !yield(ln.leaf.origKey(), ln.leaf.val) {
+				return
+			}
+		}
+	}
+}
+
+// IterateFilter returns an iterator over the entries for which pred returns
+// true, in key order.
+func (n *Node[T]) IterateFilter(pred func(k []byte, v T) bool) iter.Seq2[[]byte, T] {
+	return n.IterateFilterPrune(pred, nil)
+}
+
+// IterateFilterPrune is like IterateFilter, but also calls prune with the path
+// of each node on the way down, and skips the whole subtree under any path for
+// which it returns true without visiting it. This is only correct if prune is
+// monotonic, so that once it returns true for a path, none of the keys that
+// start with that path would pass pred. The path given to prune is only valid
+// for the duration of the call, and a nil prune never skips anything.
+func (n *Node[T]) IterateFilterPrune(pred func(k []byte, v T) bool, prune func(prefix []byte) bool) iter.Seq2[[]byte, T] {
+	return func(yield func([]byte, T) bool) {
+		filterWalk(n, nil, pred, prune, yield)
+	}
+}
+
+// filterWalk does the work for IterateFilterPrune, where path is the path down
+// to n, not including n's own prefix. Returns false if yield stopped the walk.
+func filterWalk[T any](n *Node[T], path []byte, pred func([]byte, T) bool, prune func([]byte) bool, yield func([]byte, T) bool) bool {
+	path = append(path, n.prefix...)
+	if prune != nil && prune(path) {
+		return true
+	}
+	if n.leaf != nil && pred(n.leaf.key, n.leaf.val) && !yield(n.leaf.key, n.leaf.val) {
+		return false
+	}
+	for _, e := range n.edges {
+		if !filterWalk(e.node, path, pred, prune, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupBy walks the tree in key order and calls fn with each run of
+// consecutive entries for which keyFn returns the same group, such as the
+// first segment of the key. Since the keys are sorted, a group only comes up
+// once as long as keyFn gives the same result for all the keys between any two
+// in the group; otherwise it's split into several runs. For example, grouping
+// by the first dot-separated segment splits "acme" from "acme.users" if there's
+// an "acme-x" key, which sorts between them. Only one group's entries are held
+// at a time. Like the iterators, and unlike Walk, returning false from fn stops
+// the walk. The items slice is reused between calls, so fn must copy it to keep
+// it.
+func (n *Node[T]) GroupBy(keyFn func(key []byte) []byte, fn func(group []byte, items []KV[T]) bool) {
+	var group []byte
+	var items []KV[T]
+	stopped := recursiveWalk(n, func(k []byte, v T) bool {
+		g := keyFn(k)
+		if len(items) > 0 && !bytes.Equal(g, group) {
+			if !fn(group, items) {
+				return true
+			}
+			items = items[:0]
+		}
+		group = g
+		items = append(items, KV[T]{k, v})
+		return false
+	})
+	if !stopped && len(items) > 0 {
+		fn(group, items)
+	}
+}
+
 // WalkPath is used to walk the tree, but only visiting nodes
 // from the root down to a given leaf. Where WalkPrefix walks
 // all the entries *under* the given prefix, this walks the
@@ -292,6 +994,308 @@ func (n *Node[T]) WalkPath(path []byte, fn WalkFn[T]) {
 	}
 }
 
+// PathWatch returns the entries for every key that is a prefix of the given
+// key, from the shortest to the longest just like WalkPath, along with the
+// watch channels of the nodes on the way down to the key, starting with the
+// root. Together the channels cover every change that would alter the
+// entries: one of them is closed when any of the entries is modified or
+// deleted, or a new key is inserted on the path, so a caller that has merged
+// the entries into a result only needs to do it again once a channel fires.
+// A node's channel is also closed by writes to any other key under it though,
+// and every write goes under the root, so it's up to the caller whether to
+// watch all of the channels or to skip the shallowest ones. Channels are only
+// closed by transactions with TrackMutate enabled.
+func (n *Node[T]) PathWatch(key []byte) (values []KV[T], watches []<-chan struct{}) {
+	search := key
+	for {
+		watches = append(watches, n.mutateCh)
+		if n.leaf != nil {
+			values = append(values, KV[T]{n.leaf.key, n.leaf.val})
+		}
+
+		// Check for key exhaustion
+		if len(search) == 0 {
+			return values, watches
+		}
+
+		// Look for an edge. Even if the child goes past the key or diverges
+		// from it, a key inserted on the path would split it, so its
+		// channel is needed too.
+		_, n = n.getEdge(search[0])
+		if n == nil {
+			return values, watches
+		}
+		if !bytes.HasPrefix(search, n.prefix) {
+			watches = append(watches, n.mutateCh)
+			return values, watches
+		}
+		search = search[len(n.prefix):]
+	}
+}
+
+// Select returns a new tree holding only the entries for the given keys that
+// exist in this tree, in the same shape they'd have if they had been inserted
+// into an empty tree. Keys that don't exist are simply left out. The keys are
+// sorted so that the tree is descended just once, visiting each node on the
+// way to any of the keys a single time, and subtrees that are selected in full
+// are shared with this tree rather than copied.
+func (n *Node[T]) Select(keys [][]byte) *Node[T] {
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	// Drop any duplicates, which are now adjacent.
+	uniq := sorted[:0]
+	for i, k := range sorted {
+		if i > 0 && bytes.Equal(k, sorted[i-1]) {
+			continue
+		}
+		uniq = append(uniq, k)
+	}
+
+	return asRoot(selectKeys(n, uniq, 0))
+}
+
+// asRoot returns a root node for the subset built by subsetNode, which may be
+// nil if it's empty.
+func asRoot[T any](root *Node[T]) *Node[T] {
+	if root == nil {
+		return &Node[T]{mutateCh: make(chan struct{})}
+	}
+	if len(root.prefix) > 0 {
+		// The root never carries a prefix, so hang the collapsed node
+		// off a fresh one.
+		root = &Node[T]{
+			mutateCh: make(chan struct{}),
+			edges:    edges[T]{{label: root.prefix[0], node: root}},
+			size:     root.size,
+		}
+	}
+	return root
+}
+
+// selectKeys returns a node holding just the leaves under n whose keys are in
+// keys, or nil if there are none. The keys must be sorted, free of duplicates,
+// and all start with n's path, which is depth bytes long.
+func selectKeys[T any](n *Node[T], keys [][]byte, depth int) *Node[T] {
+	nc := &Node[T]{
+		mutateCh: make(chan struct{}),
+		prefix:   n.prefix,
+	}
+
+	// Since the keys are sorted, a key for this node itself comes first.
+	if len(keys) > 0 && len(keys[0]) == depth {
+		nc.leaf = n.leaf
+		keys = keys[1:]
+	}
+
+	// Descend into each child once with all of the keys beneath it.
+	for len(keys) > 0 {
+		label := keys[0][depth]
+		end := 1
+		for end < len(keys) && keys[end][depth] == label {
+			end++
+		}
+		group := keys[:end]
+		keys = keys[end:]
+
+		_, child := n.getEdge(label)
+		if child == nil {
+			continue
+		}
+		childDepth := depth + len(child.prefix)
+		var under [][]byte
+		for _, k := range group {
+			if len(k) >= childDepth && bytes.Equal(k[depth:childDepth], child.prefix) {
+				under = append(under, k)
+			}
+		}
+		if sub := selectKeys(child, under, childDepth); sub != nil {
+			nc.edges = append(nc.edges, edge[T]{label: label, node: sub})
+		}
+	}
+	return subsetNode(n, nc)
+}
+
+// subsetNode finishes nc, a new node holding some of the leaf and children of
+// n, with their subtrees possibly cut down. It returns n itself if nothing was
+// left out, nil if nothing was kept, and otherwise nc, collapsed into its only
+// child if it's left with no leaf of its own. nc must have n's prefix.
+func subsetNode[T any](n, nc *Node[T]) *Node[T] {
+	// Share this node if everything beneath it was selected.
+	if nc.leaf == n.leaf && len(nc.edges) == len(n.edges) {
+		same := true
+		for i, e := range nc.edges {
+			if e.node != n.edges[i].node {
+				same = false
+				break
+			}
+		}
+		if same {
+			return n
+		}
+	}
+
+	switch {
+	case nc.leaf == nil && len(nc.edges) == 0:
+		return nil
+	case nc.leaf == nil && len(nc.edges) == 1:
+		// Collapse into the only child, without modifying it.
+		child := nc.edges[0].node
+		return &Node[T]{
+			mutateCh: make(chan struct{}),
+			prefix:   concat(nc.prefix, child.prefix),
+			leaf:     child.leaf,
+			edges:    child.edges,
+			size:     child.size,
+		}
+	}
+	if nc.leaf != nil {
+		nc.size = 1
+	}
+	for _, e := range nc.edges {
+		nc.size += e.node.size
+	}
+	return nc
+}
+
+// IsCanonical returns true if the tree under this node has the structure that
+// inserting its keys into an empty tree would give, which is what deletes are
+// expected to preserve by collapsing nodes as they empty out. In particular,
+// apart from the root, every node must have a non-empty prefix and either hold
+// a leaf or have at least two children, so there are no chains of single-child
+// nodes to step through on lookups. No node may be left holding an empty edge
+// slice, and edges must be sorted and labelled with their child's first byte.
+func (n *Node[T]) IsCanonical() bool {
+	return canonicalError(n, true) == ""
+}
+
+// canonicalError returns a description of the first way in which the subtree
+// under n isn't canonical, as defined by IsCanonical, or the empty string if
+// it's canonical.
+func canonicalError[T any](n *Node[T], root bool) string {
+	if n.edges != nil && len(n.edges) == 0 {
+		return fmt.Sprintf("node %q has an empty edge slice", n.prefix)
+	}
+	if !root {
+		switch {
+		case len(n.prefix) == 0:
+			return "non-root node has an empty prefix"
+		case !n.isLeaf() && len(n.edges) == 0:
+			return fmt.Sprintf("node %q is empty", n.prefix)
+		case !n.isLeaf() && len(n.edges) == 1:
+			return fmt.Sprintf("node %q should be merged with its only child", n.prefix)
+		}
+	}
+	for i, e := range n.edges {
+		if len(e.node.prefix) == 0 || e.label != e.node.prefix[0] {
+			return fmt.Sprintf("edge %q of node %q doesn't match its child %q", e.label, n.prefix, e.node.prefix)
+		}
+		if i > 0 && n.edges[i-1].label >= e.label {
+			return fmt.Sprintf("edges of node %q are out of order", n.prefix)
+		}
+		if err := canonicalError(e.node, false); err != "" {
+			return err
+		}
+	}
+	return ""
+}
+
+// ResolvePath folds the values of every key that is a prefix of the given
+// key into a single result, starting with init. This visits the same entries
+// as WalkPath, from the shortest prefix to the longest, so merge sees values of
+// increasing specificity; this is the usual way to resolve layered settings
+// where defaults at the top are overridden by more specific keys. If no key is
+// a prefix of the given key then init is returned.
+func (n *Node[T]) ResolvePath(key []byte, merge func(acc, v T) T, init T) T {
+	acc := init
+	i := n.PathIterator(key)
+	for _, val, ok := i.Next(); ok; _, val, ok = i.Next() {
+		acc = merge(acc, val)
+	}
+	return acc
+}
+
+// Collect folds every entry whose key starts with the given prefix into a
+// single result, starting with init and visiting the entries in key order.
+// An empty prefix folds the whole tree. This is the general form of
+// aggregations like ValuesPrefix, for results of a different type than the
+// values; it's a function rather than a method because methods can't add
+// type parameters. If no key starts with the prefix then init is returned.
+func Collect[T, R any](n *Node[T], prefix []byte, init R, visit func(R, []byte, T) R) R {
+	acc := init
+	if pn := n.prefixNode(prefix); pn != nil {
+		walkLeaves(pn, func(l *leafNode[T]) {
+			acc = visit(acc, l.key, l.val)
+		})
+	}
+	return acc
+}
+
+// Sample returns k entries chosen uniformly at random from the subtree under
+// this node, without repeats, in key order. If k is at least the number of
+// entries then all of them are returned. Each entry is found by descending
+// with the cached subtree sizes, so this costs O(k·depth) and doesn't visit
+// the rest of the tree. The choice only depends on rng, so a seeded source
+// gives the same sample every time for the same tree.
+func (n *Node[T]) Sample(k int, rng *rand.Rand) []KV[T] {
+	if k <= 0 {
+		return nil
+	}
+	if k >= n.size {
+		out := make([]KV[T], 0, n.size)
+		walkLeaves(n, func(l *leafNode[T]) {
+			out = append(out, KV[T]{l.key, l.val})
+		})
+		return out
+	}
+
+	// Pick k distinct positions using Floyd's algorithm, which doesn't need
+	// to hold all n.size positions.
+	picked := make(map[int]struct{}, k)
+	for j := n.size - k; j < n.size; j++ {
+		i := rng.Intn(j + 1)
+		if _, ok := picked[i]; ok {
+			i = j
+		}
+		picked[i] = struct{}{}
+	}
+	positions := make([]int, 0, k)
+	for i := range picked {
+		positions = append(positions, i)
+	}
+	sort.Ints(positions)
+
+	out := make([]KV[T], 0, k)
+	for _, i := range positions {
+		l := leafAt(n, i)
+		out = append(out, KV[T]{l.key, l.val})
+	}
+	return out
+}
+
+// leafAt returns the leaf at the given position in key order in the subtree
+// under n, which must be less than n.size.
+func leafAt[T any](n *Node[T], i int) *leafNode[T] {
+	for {
+		if n.leaf != nil {
+			if i == 0 {
+				return n.leaf
+			}
+			i--
+		}
+		for _, e := range n.edges {
+			if i < e.node.size {
+				n = e.node
+				break
+			}
+			i -= e.node.size
+		}
+	}
+}
+
 // recursiveWalk is used to do a pre-order walk of a node
 // recursively. Returns true if the walk should be aborted
 func recursiveWalk[T any](n *Node[T], fn WalkFn[T]) bool {
@@ -4,6 +4,12 @@
 package iradix
 
 import (
+	"bytes"
+	"fmt"
+	"iter"
+	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -48,3 +54,1580 @@ func TestNodeWalkBackwards(t *testing.T) {
 		return i < 0
 	})
 }
+
+func TestNodeResolvePath(t *testing.T) {
+	r := New[int]()
+	for k, v := range map[string]int{
+		"":         1,
+		"tenant":   2,
+		"tenant.a": 3,
+		"other":    4,
+	} {
+		r, _, _ = r.Insert([]byte(k), v)
+	}
+
+	// Later (more specific) values override earlier ones.
+	override := func(_, v int) int { return v }
+	cases := map[string]int{
+		"tenant.a.x": 3,
+		"tenant.a":   3,
+		"tenant.b":   2,
+		"tenant":     2,
+		"foo":        1,
+	}
+	for key, want := range cases {
+		if got := r.Root().ResolvePath([]byte(key), override, -1); got != want {
+			t.Fatalf("bad: %q got %d want %d", key, got, want)
+		}
+	}
+
+	// The merge sees the values in order of increasing specificity.
+	var seen []int
+	r.Root().ResolvePath([]byte("tenant.a.x"), func(acc, v int) int {
+		seen = append(seen, v)
+		return acc
+	}, 0)
+	if len(seen) != 3 || seen[0] != 1 || seen[1] != 2 || seen[2] != 3 {
+		t.Fatalf("bad: %v", seen)
+	}
+
+	// Without any matching prefix the initial value comes back.
+	r, _, _ = r.Delete(nil)
+	if got := r.Root().ResolvePath([]byte("foo"), override, -1); got != -1 {
+		t.Fatalf("bad: %d", got)
+	}
+}
+
+func TestNodeResolvePath_Struct(t *testing.T) {
+	type config struct {
+		Region  string
+		Limit   int
+		Verbose bool
+	}
+	merge := func(acc, v config) config {
+		if v.Region != "" {
+			acc.Region = v.Region
+		}
+		if v.Limit != 0 {
+			acc.Limit = v.Limit
+		}
+		acc.Verbose = acc.Verbose || v.Verbose
+		return acc
+	}
+
+	r := New[config]()
+	r, _, _ = r.Insert([]byte("svc"), config{Region: "us", Limit: 10})
+	r, _, _ = r.Insert([]byte("svc.api"), config{Limit: 50})
+	r, _, _ = r.Insert([]byte("svc.api.debug"), config{Verbose: true})
+
+	got := r.Root().ResolvePath([]byte("svc.api.debug"), merge, config{Region: "eu", Limit: 1})
+	want := config{Region: "us", Limit: 50, Verbose: true}
+	if got != want {
+		t.Fatalf("bad: %+v", got)
+	}
+	got = r.Root().ResolvePath([]byte("svc.web"), merge, config{})
+	want = config{Region: "us", Limit: 10}
+	if got != want {
+		t.Fatalf("bad: %+v", got)
+	}
+}
+
+// sameShape reports whether two nodes have the same prefixes, edges and keys
+// throughout.
+func sameShape[T any](a, b *Node[T]) bool {
+	if !bytes.Equal(a.prefix, b.prefix) || a.isLeaf() != b.isLeaf() || len(a.edges) != len(b.edges) {
+		return false
+	}
+	if a.isLeaf() && !bytes.Equal(a.leaf.key, b.leaf.key) {
+		return false
+	}
+	for i := range a.edges {
+		if a.edges[i].label != b.edges[i].label || !sameShape(a.edges[i].node, b.edges[i].node) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNodeSelect(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"", "foo", "foobar", "foobaz", "foozip", "zip", "zipper"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	keys := [][]byte{
+		[]byte("foobaz"),
+		[]byte("nope"),
+		[]byte("zipper"),
+		[]byte("foob"),
+		[]byte("foobar"),
+		[]byte("zipper"),
+		[]byte("zipperx"),
+	}
+	sel := r.Root().Select(keys)
+
+	var got []string
+	sel.Walk(func(k []byte, v int) bool {
+		got = append(got, fmt.Sprintf("%s=%d", k, v))
+		return false
+	})
+	expect := []string{"foobar=2", "foobaz=3", "zipper=6"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad: %v", got)
+	}
+	if sel.size != 3 {
+		t.Fatalf("bad: %d", sel.size)
+	}
+
+	// The result has the same shape as a tree with just those keys.
+	fresh := New[int]()
+	for _, k := range []string{"foobar", "foobaz", "zipper"} {
+		fresh, _, _ = fresh.Insert([]byte(k), 0)
+	}
+	if !sameShape(sel, fresh.Root()) {
+		t.Fatalf("bad shape")
+	}
+
+	// Fully selected subtrees are shared.
+	_, fooba := r.Root().getEdge('f')
+	_, fooba = fooba.getEdge('b')
+	_, selFooba := sel.getEdge('f')
+	if fooba == nil || selFooba == nil {
+		t.Fatalf("missing node")
+	}
+	if selFooba.edges[0].node != fooba.edges[0].node || selFooba.edges[1].node != fooba.edges[1].node {
+		t.Fatalf("leaves weren't shared")
+	}
+
+	// The original tree is untouched.
+	if r.Len() != 7 {
+		t.Fatalf("bad: %d", r.Len())
+	}
+	if v, ok := r.Get([]byte("foozip")); !ok || v != 4 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+
+	// Selecting nothing that exists gives an empty tree.
+	empty := r.Root().Select([][]byte{[]byte("nope")})
+	if empty.size != 0 || empty.isLeaf() || len(empty.edges) != 0 {
+		t.Fatalf("bad: %#v", empty)
+	}
+	if r.Root().Select(nil).size != 0 {
+		t.Fatalf("expected empty tree")
+	}
+
+	// Selecting everything gives back the same root.
+	all := [][]byte{[]byte(""), []byte("foo"), []byte("foobar"), []byte("foobaz"),
+		[]byte("foozip"), []byte("zip"), []byte("zipper")}
+	if r.Root().Select(all) != r.Root() {
+		t.Fatalf("expected the root to be shared")
+	}
+}
+
+func TestNodeSelect_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() string {
+		const letters = "ab/"
+		b := make([]byte, rnd.Intn(5))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return string(b)
+	}
+
+	for round := 0; round < 200; round++ {
+		r := New[int]()
+		for i := 0; i < 20; i++ {
+			r, _, _ = r.Insert([]byte(randKey()), i)
+		}
+
+		var keys [][]byte
+		fresh := New[int]()
+		for i := 0; i < 10; i++ {
+			k := randKey()
+			keys = append(keys, []byte(k))
+			if v, ok := r.Get([]byte(k)); ok {
+				fresh, _, _ = fresh.Insert([]byte(k), v)
+			}
+		}
+
+		sel := r.Root().Select(keys)
+		checkSizes(t, sel)
+		if !sameShape(sel, fresh.Root()) {
+			t.Fatalf("bad shape for %q", keys)
+		}
+		if sel.size != fresh.Len() {
+			t.Fatalf("bad: %d %d", sel.size, fresh.Len())
+		}
+		fresh.Root().Walk(func(k []byte, v int) bool {
+			if got, ok := sel.Get(k); !ok || got != v {
+				t.Fatalf("bad: %q %v %v", k, got, ok)
+			}
+			return false
+		})
+	}
+}
+
+func TestNodeContains(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	root := r.Root()
+
+	type exp struct {
+		inp      string
+		contains bool
+		prefix   bool
+	}
+	cases := []exp{
+		{"foo", true, true},
+		{"foobar", true, true},
+		{"zip", true, true},
+		{"fo", false, true},
+		{"foob", false, true},
+		{"foobarbaz", false, false},
+		{"zipper", false, false},
+		{"z", false, true},
+		{"x", false, false},
+		{"", false, true},
+	}
+	for _, test := range cases {
+		if got := root.Contains([]byte(test.inp)); got != test.contains {
+			t.Fatalf("bad: %q got %v want %v", test.inp, got, test.contains)
+		}
+		if got := root.ContainsPrefix([]byte(test.inp)); got != test.prefix {
+			t.Fatalf("bad prefix: %q got %v want %v", test.inp, got, test.prefix)
+		}
+	}
+
+	// The common mistake: LongestPrefix finds "zip" for "zipper", which
+	// isn't in the tree.
+	if _, _, ok := root.LongestPrefix([]byte("zipper")); !ok {
+		t.Fatalf("expected a longest prefix match")
+	}
+	if root.Contains([]byte("zipper")) {
+		t.Fatalf("zipper isn't a member")
+	}
+
+	// An empty tree contains nothing, not even the empty prefix.
+	empty := New[int]().Root()
+	if empty.Contains(nil) || empty.ContainsPrefix(nil) {
+		t.Fatalf("empty tree shouldn't contain anything")
+	}
+	r, _, _ = r.Insert(nil, 0)
+	if !r.Root().Contains(nil) {
+		t.Fatalf("expected the empty key")
+	}
+}
+
+func TestNodeIteratePrefixTrimmed(t *testing.T) {
+	r := New[int]()
+	keys := []string{"tenant.abc", "tenant.abc.x", "tenant.abc.y.z", "tenant.abcd", "tenant.b", "other"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	collect := func(prefix string) []string {
+		var out []string
+		for k, v := range r.Root().IteratePrefixTrimmed([]byte(prefix)) {
+			out = append(out, fmt.Sprintf("%s=%d", k, v))
+		}
+		return out
+	}
+
+	cases := map[string][]string{
+		"tenant.abc.": {"x=1", "y.z=2"},
+		"tenant.abc":  {"=0", ".x=1", ".y.z=2", "d=3"},
+		"tenant.a":    {"bc=0", "bc.x=1", "bc.y.z=2", "bcd=3"},
+		"tenant.b":    {"=4"},
+		"":            {"other=5", "tenant.abc=0", "tenant.abc.x=1", "tenant.abc.y.z=2", "tenant.abcd=3", "tenant.b=4"},
+		"tenant.c":    nil,
+		"nope":        nil,
+	}
+	for prefix, expect := range cases {
+		if got := collect(prefix); !reflect.DeepEqual(got, expect) {
+			t.Fatalf("bad: %q got %v want %v", prefix, got, expect)
+		}
+	}
+
+	// Breaking out early stops the iteration.
+	n := 0
+	for range r.Root().IteratePrefixTrimmed([]byte("tenant.")) {
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestNodeGetWatch_SingleKey(t *testing.T) {
+	update := func(r *Tree[int], fn func(txn *Txn[int])) *Tree[int] {
+		txn := r.Txn()
+		txn.TrackMutate(true)
+		fn(txn)
+		return txn.Commit()
+	}
+	closed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	r := New[int]()
+	r = update(r, func(txn *Txn[int]) {
+		txn.Insert([]byte("config/a"), 1)
+		txn.Insert([]byte("config/b"), 2)
+	})
+
+	watch, v, ok := r.Root().GetWatch([]byte("config/a"))
+	if !ok || v != 1 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+
+	// Writing to siblings, or adding keys beneath, doesn't fire the watch.
+	r = update(r, func(txn *Txn[int]) {
+		txn.Insert([]byte("config/b"), 20)
+		txn.Insert([]byte("config/c"), 3)
+		txn.Insert([]byte("config/ab"), 4)
+		txn.Delete([]byte("config/b"))
+	})
+	if closed(watch) {
+		t.Fatalf("watch fired for a sibling")
+	}
+
+	// Modifying the key does.
+	r = update(r, func(txn *Txn[int]) { txn.Insert([]byte("config/a"), 10) })
+	if !closed(watch) {
+		t.Fatalf("watch didn't fire on modify")
+	}
+
+	// So does deleting it.
+	watch, _, _ = r.Root().GetWatch([]byte("config/a"))
+	r = update(r, func(txn *Txn[int]) { txn.Delete([]byte("config/a")) })
+	if !closed(watch) {
+		t.Fatalf("watch didn't fire on delete")
+	}
+
+	// Watching an absent key fires when it's inserted.
+	watch, _, ok = r.Root().GetWatch([]byte("config/a"))
+	if ok {
+		t.Fatalf("expected the key to be absent")
+	}
+	if closed(watch) {
+		t.Fatalf("watch fired early")
+	}
+	r = update(r, func(txn *Txn[int]) { txn.Insert([]byte("config/a"), 100) })
+	if !closed(watch) {
+		t.Fatalf("watch didn't fire on insert")
+	}
+	if v, ok := r.Root().Get([]byte("config/a")); !ok || v != 100 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+}
+
+// checkCanonical fails the test if the tree under n isn't canonical, saying
+// why.
+func checkCanonical[T any](t *testing.T, n *Node[T]) {
+	t.Helper()
+	if err := canonicalError(n, true); err != "" {
+		t.Fatalf("not canonical: %s", err)
+	}
+	if !n.IsCanonical() {
+		t.Fatalf("bad")
+	}
+}
+
+func TestNodeIsCanonical(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"foo", "foobar", "foobaz", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	checkCanonical(t, r.Root())
+	checkCanonical(t, New[int]().Root())
+
+	// Deleting all the children of a leaf node shouldn't leave an empty
+	// edge slice behind.
+	r, _, _ = r.Delete([]byte("foobar"))
+	r, _, _ = r.Delete([]byte("foobaz"))
+	checkCanonical(t, r.Root())
+	_, foo := r.Root().getEdge('f')
+	if foo.edges != nil {
+		t.Fatalf("bad: %#v", foo.edges)
+	}
+
+	// Hand-built degenerate trees are caught.
+	leaf := func(k string) *leafNode[int] { return &leafNode[int]{key: []byte(k)} }
+	chain := &Node[int]{
+		edges: edges[int]{{label: 'a', node: &Node[int]{
+			prefix: []byte("a"),
+			edges: edges[int]{{label: 'b', node: &Node[int]{
+				prefix: []byte("b"),
+				leaf:   leaf("ab"),
+			}}},
+		}}},
+	}
+	if chain.IsCanonical() {
+		t.Fatalf("expected a single-child chain to be caught")
+	}
+	stray := &Node[int]{
+		edges: edges[int]{{label: 'a', node: &Node[int]{
+			prefix: []byte("a"),
+			leaf:   leaf("a"),
+			edges:  make(edges[int], 0, 4),
+		}}},
+	}
+	if stray.IsCanonical() {
+		t.Fatalf("expected an empty edge slice to be caught")
+	}
+	empty := &Node[int]{
+		edges: edges[int]{{label: 'a', node: &Node[int]{prefix: []byte("a")}}},
+	}
+	if empty.IsCanonical() {
+		t.Fatalf("expected an empty node to be caught")
+	}
+}
+
+func TestNodeIsCanonical_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab/"
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 100; round++ {
+		r := New[int]()
+		for i := 0; i < 200; i++ {
+			txn := r.Txn()
+			for j := 0; j < rnd.Intn(4)+1; j++ {
+				switch rnd.Intn(5) {
+				case 0, 1:
+					txn.Insert(randKey(), i)
+				case 2, 3:
+					txn.Delete(randKey())
+				default:
+					txn.DeletePrefix(randKey())
+				}
+			}
+			r = txn.Commit()
+			checkCanonical(t, r.Root())
+		}
+	}
+}
+
+func TestNodeLenPrefix(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"", "foo", "foobar", "foobaz", "foozip", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	cases := map[string]int{
+		"":        6,
+		"f":       4,
+		"foo":     4,
+		"foob":    2,
+		"fooba":   2,
+		"foobar":  1,
+		"foobarx": 0,
+		"z":       1,
+		"x":       0,
+	}
+	for prefix, want := range cases {
+		if got := r.Root().LenPrefix([]byte(prefix)); got != want {
+			t.Fatalf("bad: %q got %d want %d", prefix, got, want)
+		}
+		var count int
+		r.Root().WalkPrefix([]byte(prefix), func([]byte, int) bool {
+			count++
+			return false
+		})
+		if count != want {
+			t.Fatalf("bad: %q walked %d want %d", prefix, count, want)
+		}
+	}
+}
+
+func BenchmarkNodeLenPrefix(b *testing.B) {
+	txn := New[int]().Txn()
+	for i := 0; i < 100000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("tenant.big.%06d", i)), i)
+		txn.Insert([]byte(fmt.Sprintf("tenant.small.%06d", i%100)), i)
+	}
+	root := txn.Commit().Root()
+	prefix := []byte("tenant.big.")
+
+	b.Run("LenPrefix", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if root.LenPrefix(prefix) != 100000 {
+				b.Fatalf("bad")
+			}
+		}
+	})
+	b.Run("WalkPrefix", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			count := 0
+			root.WalkPrefix(prefix, func([]byte, int) bool {
+				count++
+				return false
+			})
+			if count != 100000 {
+				b.Fatalf("bad")
+			}
+		}
+	})
+}
+
+func TestNodeWalkDepth(t *testing.T) {
+	r := New[int]()
+	keys := []string{
+		"a",
+		"a.b",
+		"a.b.c",
+		"a.b.c.d",
+		"a.b.c.d.e",
+		"a.bb",
+		"a.bb.cc.dd",
+		"a..b",
+		"ab",
+		"x.y",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	collect := func(prefix string, maxDepth int) []string {
+		var out []string
+		r.Root().WalkDepth([]byte(prefix), maxDepth, func(k []byte, _ int) bool {
+			out = append(out, string(k))
+			return false
+		})
+		return out
+	}
+
+	type exp struct {
+		prefix   string
+		maxDepth int
+		out      []string
+	}
+	cases := []exp{
+		{"a.", 0, nil},
+		{"a.", 1, []string{"a..b", "a.b", "a.bb"}},
+		{"a.", 2, []string{"a..b", "a.b", "a.b.c", "a.bb"}},
+		{"a.", 3, []string{"a..b", "a.b", "a.b.c", "a.b.c.d", "a.bb", "a.bb.cc.dd"}},
+		{"a", 0, []string{"a"}},
+		{"a", 1, []string{"a", "a..b", "a.b", "a.bb", "ab"}},
+		{"a.b", 0, []string{"a.b"}},
+		{"a.b", 1, []string{"a.b", "a.b.c", "a.bb"}},
+		{"a.b.c.", 2, []string{"a.b.c.d", "a.b.c.d.e"}},
+		{"", 1, []string{"a", "ab"}},
+		{"", 2, []string{"a", "a..b", "a.b", "a.bb", "ab", "x.y"}},
+		{"nope", 5, nil},
+	}
+	for _, test := range cases {
+		if got := collect(test.prefix, test.maxDepth); !reflect.DeepEqual(got, test.out) {
+			t.Fatalf("bad: %q %d got %v want %v", test.prefix, test.maxDepth, got, test.out)
+		}
+	}
+
+	// The walk can be stopped early.
+	var seen []string
+	stopped := r.Root().WalkDepth([]byte("a."), 5, func(k []byte, _ int) bool {
+		seen = append(seen, string(k))
+		return len(seen) == 2
+	})
+	if !stopped || len(seen) != 2 {
+		t.Fatalf("bad: %v %v", stopped, seen)
+	}
+	if r.Root().WalkDepth([]byte("a."), 5, func([]byte, int) bool { return false }) {
+		t.Fatalf("expected a full walk")
+	}
+}
+
+func TestNodeKeysWithSuffix(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"svc.read", "svc.api.read", "read", "ead", "svc.write", "svc.reread", "x.read.x"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	toStrings := func(keys [][]byte) []string {
+		var out []string
+		for _, k := range keys {
+			out = append(out, string(k))
+		}
+		return out
+	}
+
+	cases := map[string][]string{
+		".read":               {"svc.api.read", "svc.read"},
+		"read":                {"read", "svc.api.read", "svc.read", "svc.reread"},
+		"ead":                 {"ead", "read", "svc.api.read", "svc.read", "svc.reread"},
+		"reread":              {"svc.reread"},
+		"x":                   {"x.read.x"},
+		"long.read":           nil,
+		"svc.api.read.longer": nil,
+		"":                    {"ead", "read", "svc.api.read", "svc.read", "svc.reread", "svc.write", "x.read.x"},
+	}
+	for suffix, want := range cases {
+		if got := toStrings(r.Root().KeysWithSuffix([]byte(suffix))); !reflect.DeepEqual(got, want) {
+			t.Fatalf("bad: %q got %v want %v", suffix, got, want)
+		}
+	}
+}
+
+func TestNodeChildSegmentCount(t *testing.T) {
+	r := New[int]()
+	keys := []string{
+		"tenant",
+		"tenant.",
+		"tenant.a.x",
+		"tenant.a.y",
+		"tenant.ab1.z",
+		"tenant.ab2",
+		"tenant.ab",
+		"tenant.b",
+		"tenantx.c",
+		"other.a",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	cases := map[string]int{
+		"tenant.":      5, // a, ab, ab1, ab2, b
+		"tenant":       5,
+		"tenant.a":     2, // x and y, but not ab1 and so on
+		"tenant.a.":    2,
+		"tenant.ab":    0,
+		"tenant.ab1":   1,
+		"tenant.ab1.z": 0,
+		"tenant.b":     0,
+		"tenantx":      1,
+		"":             3, // other, tenant, tenantx
+		"nope":         0,
+	}
+	for prefix, want := range cases {
+		if got := r.Root().ChildSegmentCount([]byte(prefix), '.'); got != want {
+			t.Fatalf("bad: %q got %d want %d", prefix, got, want)
+		}
+	}
+
+	// Check against the segments found by walking everything.
+	for prefix := range cases {
+		seen := make(map[string]struct{})
+		r.Root().WalkPrefix([]byte(prefix), func(k []byte, _ int) bool {
+			rest := string(k[len(prefix):])
+			if prefix != "" && !strings.HasSuffix(prefix, ".") {
+				if !strings.HasPrefix(rest, ".") {
+					return false
+				}
+				rest = rest[1:]
+			}
+			if rest == "" {
+				return false
+			}
+			seg, _, _ := strings.Cut(rest, ".")
+			seen[seg] = struct{}{}
+			return false
+		})
+		if got := r.Root().ChildSegmentCount([]byte(prefix), '.'); got != len(seen) {
+			t.Fatalf("bad: %q got %d want %d", prefix, got, len(seen))
+		}
+	}
+}
+
+func TestNodeIterateFilter(t *testing.T) {
+	r := New[bool]()
+	active := map[string]bool{
+		"active.a":     true,
+		"active.b":     true,
+		"active.c.d":   true,
+		"inactive.a":   false,
+		"inactive.b.c": false,
+		"act":          false,
+		"mixed.a":      true,
+		"mixed.b":      false,
+	}
+	for k, v := range active {
+		r, _, _ = r.Insert([]byte(k), v)
+	}
+
+	collect := func(seq iter.Seq2[[]byte, bool]) []string {
+		var out []string
+		for k := range seq {
+			out = append(out, string(k))
+		}
+		return out
+	}
+	pred := func(_ []byte, v bool) bool { return v }
+	expect := []string{"active.a", "active.b", "active.c.d", "mixed.a"}
+	if got := collect(r.Root().IterateFilter(pred)); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Pruning the inactive namespace gives the same entries without
+	// visiting it.
+	var visited []string
+	prune := func(prefix []byte) bool {
+		visited = append(visited, string(prefix))
+		return bytes.HasPrefix(prefix, []byte("ina"))
+	}
+	var predKeys []string
+	countingPred := func(k []byte, v bool) bool {
+		predKeys = append(predKeys, string(k))
+		return v
+	}
+	if got := collect(r.Root().IterateFilterPrune(countingPred, prune)); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad: %v", got)
+	}
+	for _, k := range predKeys {
+		if strings.HasPrefix(k, "inactive") {
+			t.Fatalf("pruned key %q was considered", k)
+		}
+	}
+	if len(visited) == 0 || visited[0] != "" {
+		t.Fatalf("bad: %v", visited)
+	}
+
+	// Pruning everything gives nothing, and stopping early works.
+	if got := collect(r.Root().IterateFilterPrune(pred, func([]byte) bool { return true })); got != nil {
+		t.Fatalf("bad: %v", got)
+	}
+	n := 0
+	for range r.Root().IterateFilter(pred) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestNodeValuesPrefix(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"", "foo", "foobar", "foobaz", "foozip", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	cases := map[string][]int{
+		"":       {0, 1, 2, 3, 4, 5},
+		"foo":    {1, 2, 3, 4},
+		"foob":   {2, 3},
+		"foobar": {2},
+		"z":      {5},
+		"nope":   {},
+		"zipper": {},
+	}
+	for prefix, want := range cases {
+		got := r.Root().ValuesPrefix([]byte(prefix))
+		if got == nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("bad: %q got %v want %v", prefix, got, want)
+		}
+	}
+}
+
+func BenchmarkNodeValuesPrefix(b *testing.B) {
+	txn := New[int]().Txn()
+	for i := 0; i < 100000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("tenant.big.%06d", i)), i)
+	}
+	root := txn.Commit().Root()
+	prefix := []byte("tenant.big.")
+
+	b.Run("ValuesPrefix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if len(root.ValuesPrefix(prefix)) != 100000 {
+				b.Fatalf("bad")
+			}
+		}
+	})
+	b.Run("Iterator", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var vals []int
+			it := root.Iterator()
+			it.SeekPrefix(prefix)
+			for _, v, ok := it.Next(); ok; _, v, ok = it.Next() {
+				vals = append(vals, v)
+			}
+			if len(vals) != 100000 {
+				b.Fatalf("bad")
+			}
+		}
+	})
+}
+
+func TestNodeNearest(t *testing.T) {
+	r := New[int]()
+	if _, _, ok := r.Root().Nearest([]byte("foo")); ok {
+		t.Fatalf("expected no match in an empty tree")
+	}
+
+	keys := []string{
+		"api/v1/users",
+		"api/v1/users/admin",
+		"api/v2/orders",
+		"api/v2/users",
+		"static/css",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	cases := []struct {
+		in  string
+		out string
+	}{
+		// Exact matches win, even over longer keys under them.
+		{"api/v1/users", "api/v1/users"},
+		// Diverging partway picks the keys sharing the most with the query.
+		{"api/v1/usage", "api/v1/users"},
+		{"api/v2/ordinal", "api/v2/orders"},
+		{"api/v1/users/adm", "api/v1/users/admin"},
+		{"api/v1/usersx", "api/v1/users"},
+		{"stat", "static/css"},
+		// Ties go to the smallest key.
+		{"api/v2/x", "api/v2/orders"},
+		{"api/v3", "api/v1/users"},
+		{"zzz", "api/v1/users"},
+		{"", "api/v1/users"},
+	}
+	for _, c := range cases {
+		k, v, ok := r.Root().Nearest([]byte(c.in))
+		if !ok || string(k) != c.out || keys[v] != c.out {
+			t.Fatalf("bad: %q: %q %d %v", c.in, k, v, ok)
+		}
+	}
+}
+
+func TestNodeNearest_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "abc"
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+	common := func(a, b []byte) int {
+		i := 0
+		for i < len(a) && i < len(b) && a[i] == b[i] {
+			i++
+		}
+		return i
+	}
+
+	for round := 0; round < 100; round++ {
+		r := New[int]()
+		var stored [][]byte
+		for i := 0; i < rnd.Intn(20)+1; i++ {
+			k := randKey()
+			if !r.Root().Contains(k) {
+				stored = append(stored, k)
+			}
+			r, _, _ = r.Insert(k, i)
+		}
+
+		for i := 0; i < 50; i++ {
+			q := randKey()
+			var want []byte
+			best := -1
+			for _, k := range stored {
+				c := common(k, q)
+				if c > best || (c == best && bytes.Compare(k, want) < 0) {
+					want, best = k, c
+				}
+			}
+			got, _, ok := r.Root().Nearest(q)
+			if !ok || !bytes.Equal(got, want) {
+				t.Fatalf("bad: %q: got %q want %q", q, got, want)
+			}
+		}
+	}
+}
+
+func TestNodeWalkIndexed(t *testing.T) {
+	r := New[int]()
+	keys := []string{"b", "a", "abc", "", "ba", "c"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	sorted := []string{"", "a", "abc", "b", "ba", "c"}
+
+	var got []string
+	r.Root().WalkIndexed(func(i int, k []byte, v int) bool {
+		if i != len(got) || keys[v] != string(k) {
+			t.Fatalf("bad: %d %q %d", i, k, v)
+		}
+		got = append(got, string(k))
+		return false
+	})
+	if !reflect.DeepEqual(got, sorted) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Stopping early still counts the entry that stopped it.
+	last, calls := -1, 0
+	r.Root().WalkIndexed(func(i int, k []byte, _ int) bool {
+		last = i
+		calls++
+		return string(k) == "abc"
+	})
+	if last != 2 || calls != 3 {
+		t.Fatalf("bad: %d %d", last, calls)
+	}
+
+	// Nothing to walk in an empty tree.
+	New[int]().Root().WalkIndexed(func(int, []byte, int) bool {
+		t.Fatalf("unexpected call")
+		return false
+	})
+}
+
+func TestNodeLongestSegmentPrefix(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"", "tenant", "tenant.abc", "tenant.abc123.x", "svc.", "a:b"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{"tenant.abc123", "tenant"},
+		{"tenant.abc", "tenant.abc"},
+		{"tenant.abc.d", "tenant.abc"},
+		{"tenant.abc123.x", "tenant.abc123.x"},
+		{"tenant.abc123.xy", "tenant"},
+		{"tenantx", "-"},
+		{"tenant", "tenant"},
+		{"svc.", "svc."},
+		{"svc.a", "-"},
+		{".a", ""},
+		{"svc..a", "svc."},
+		{"a:b.c", "a:b"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		k, _, ok := r.Root().LongestSegmentPrefix([]byte(c.in), '.')
+		if c.out == "-" {
+			if ok {
+				t.Fatalf("bad: %q: %q", c.in, k)
+			}
+			continue
+		}
+		if !ok || string(k) != c.out {
+			t.Fatalf("bad: %q: %q %v", c.in, k, ok)
+		}
+	}
+
+	// Other separators work too.
+	if k, _, _ := r.Root().LongestSegmentPrefix([]byte("a:b:c"), ':'); string(k) != "a:b" {
+		t.Fatalf("bad: %q", k)
+	}
+
+	// Without the empty key, a key starting with a separator doesn't match.
+	r, _, _ = r.Delete(nil)
+	if _, _, ok := r.Root().LongestSegmentPrefix([]byte(".a"), '.'); ok {
+		t.Fatalf("expected no match")
+	}
+}
+
+func TestNodeLongestSegmentPrefix_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab."
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 100; round++ {
+		r := New[int]()
+		for i := 0; i < 20; i++ {
+			r, _, _ = r.Insert(randKey(), i)
+		}
+		for i := 0; i < 50; i++ {
+			q := randKey()
+			var want []byte
+			found := false
+			r.Root().Walk(func(k []byte, _ int) bool {
+				if bytes.HasPrefix(q, k) && (len(k) == len(q) || q[len(k)] == '.') && (!found || len(k) > len(want)) {
+					want, found = k, true
+				}
+				return false
+			})
+			got, _, ok := r.Root().LongestSegmentPrefix(q, '.')
+			if ok != found || !bytes.Equal(got, want) {
+				t.Fatalf("bad: %q: got %q %v, want %q %v", q, got, ok, want, found)
+			}
+		}
+	}
+}
+
+func TestNodePrune(t *testing.T) {
+	r := New[int]()
+	keys := []string{"tenant.a", "tenant.a.db", "tenant.a.log.*", "tenant.ab", "tenant.b", "other"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	r, _, _ = r.InsertLiteral([]byte("tenant.a.*"), 10)
+
+	pruned := func(p *Tree[int]) map[string]int {
+		out := make(map[string]int)
+		p.Root().Walk(func(k []byte, v int) bool {
+			out[string(k)] = v
+			return false
+		})
+		return out
+	}
+
+	p := r.Root().Prune([]byte("tenant.a."))
+	if fmt.Sprint(pruned(p)) != "map[*:10 db:1 log.*:2]" {
+		t.Fatalf("bad: %v", pruned(p))
+	}
+	checkCanonical(t, p.Root())
+	checkSizes(t, p.Root())
+
+	// Literal keys stay literal, and patterns stay patterns.
+	if p.Root().MatchWithWildcards([]byte("anything")) {
+		t.Fatalf("literal key was treated as a pattern")
+	}
+	if !p.Root().MatchWithWildcards([]byte("log.x")) {
+		t.Fatalf("expected the pattern to match")
+	}
+
+	// Grafting keeps them literal too.
+	txn := New[int]().Txn()
+	txn.Graft([]byte("x."), p)
+	if g := txn.Commit(); g.Root().MatchWithWildcards([]byte("x.y")) {
+		t.Fatalf("literal key was treated as a pattern")
+	}
+
+	// A prefix partway through a node, and one equal to a key.
+	p = r.Root().Prune([]byte("tenant.a"))
+	if fmt.Sprint(pruned(p)) != "map[:0 .*:10 .db:1 .log.*:2 b:3]" {
+		t.Fatalf("bad: %v", pruned(p))
+	}
+	p = r.Root().Prune([]byte("ten"))
+	if p.Len() != 6 {
+		t.Fatalf("bad: %d", p.Len())
+	}
+
+	// Nothing under the prefix gives an empty tree, and no prefix gives a
+	// copy of the whole tree.
+	if p := r.Root().Prune([]byte("nope")); p.Len() != 0 {
+		t.Fatalf("bad: %d", p.Len())
+	}
+	if p := r.Root().Prune(nil); p.Len() != r.Len() || !sameShape(p.Root(), r.Root()) {
+		t.Fatalf("bad: %d", p.Len())
+	}
+
+	// Original keys only survive when the keys don't change.
+	lower := func(k []byte) []byte { return bytes.ToLower(k) }
+	txn = New[int]().Txn()
+	txn.InsertNormalized([]byte("Tenant.ABC"), 1, lower)
+	n := txn.Commit().Root()
+	if k, _, _ := n.Prune(nil).Root().GetNormalized([]byte("tenant.abc"), lower); string(k) != "Tenant.ABC" {
+		t.Fatalf("bad: %q", k)
+	}
+	if k, _, _ := n.Prune([]byte("tenant.")).Root().GetNormalized([]byte("abc"), lower); string(k) != "abc" {
+		t.Fatalf("bad: %q", k)
+	}
+}
+
+func TestNodePrune_Graft(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab."
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 200; round++ {
+		r := New[int]()
+		for i := 0; i < rnd.Intn(30); i++ {
+			r, _, _ = r.Insert(randKey(), i)
+		}
+		prefix := randKey()
+		prefix = prefix[:min(len(prefix), rnd.Intn(3))]
+
+		// Grafting the pruned tree back under the same prefix, in place of
+		// what was there, gives the original tree.
+		p := r.Root().Prune(prefix)
+		if p.Len() != r.Root().LenPrefix(prefix) {
+			t.Fatalf("bad: %d %d", p.Len(), r.Root().LenPrefix(prefix))
+		}
+		txn := r.Txn()
+		txn.DeletePrefix(prefix)
+		if n := txn.Graft(prefix, p); n != p.Len() {
+			t.Fatalf("bad: %d %d", n, p.Len())
+		}
+		g := txn.Commit()
+		if !sameShape(g.Root(), r.Root()) {
+			t.Fatalf("bad: %q", prefix)
+		}
+		r.Root().Walk(func(k []byte, v int) bool {
+			if got, ok := g.Get(k); !ok || got != v {
+				t.Fatalf("bad: %q: %d %v", k, got, ok)
+			}
+			return false
+		})
+	}
+}
+
+func TestNodePathWatch(t *testing.T) {
+	// Each tracked write needs its own copy of the tree, since committing
+	// two of them from the same tree would close its channels twice.
+	build := func() *Tree[int] {
+		r := New[int]()
+		keys := []string{"", "tenant", "tenant.a", "tenant.a.svc.x", "tenant.b", "other"}
+		for i, k := range keys {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		return r
+	}
+	r := build()
+
+	// The nodes on the path are the root, "tenant", ".", "a" and ".svc.x".
+	values, watches := r.Root().PathWatch([]byte("tenant.a.svc.x.y"))
+	if len(watches) != 5 {
+		t.Fatalf("bad: %d", len(watches))
+	}
+	var got []string
+	for _, kv := range values {
+		got = append(got, fmt.Sprintf("%s=%d", kv.Key, kv.Value))
+	}
+	if fmt.Sprint(got) != "[=0 tenant=1 tenant.a=2 tenant.a.svc.x=3]" {
+		t.Fatalf("bad: %v", got)
+	}
+
+	write := func(fn func(txn *Txn[int])) (*Tree[int], []bool) {
+		r := build()
+		_, watches := r.Root().PathWatch([]byte("tenant.a.svc.x.y"))
+		txn := r.Txn()
+		txn.TrackMutate(true)
+		fn(txn)
+		nr := txn.Commit()
+		closed := make([]bool, len(watches))
+		for i, ch := range watches {
+			select {
+			case <-ch:
+				closed[i] = true
+			default:
+			}
+		}
+		return nr, closed
+	}
+	deepest := func(closed []bool) bool { return closed[len(closed)-1] }
+
+	// Changing, deleting or adding any layer closes the deepest channel
+	// that covers it, and much of the path above it.
+	for _, fn := range []func(txn *Txn[int]){
+		func(txn *Txn[int]) { txn.Insert([]byte("tenant.a"), 20) },
+		func(txn *Txn[int]) { txn.Delete([]byte("tenant")) },
+		func(txn *Txn[int]) { txn.Insert([]byte("tenant.a.svc"), 30) },
+		func(txn *Txn[int]) { txn.Insert([]byte("tenant.a.svc.x.y"), 40) },
+		func(txn *Txn[int]) { txn.Insert([]byte("tenant.a.svc.x"), 50) },
+	} {
+		_, closed := write(fn)
+		if !closed[0] {
+			t.Fatalf("expected the root to be closed: %v", closed)
+		}
+		some := false
+		for _, c := range closed[1:] {
+			some = some || c
+		}
+		if !some {
+			t.Fatalf("expected a channel on the path to close: %v", closed)
+		}
+	}
+	if _, closed := write(func(txn *Txn[int]) { txn.Insert([]byte("tenant.a.svc.x"), 50) }); !deepest(closed) {
+		t.Fatalf("expected the deepest channel to close: %v", closed)
+	}
+
+	// Changes off the path only close the channels above where they
+	// diverge from it.
+	_, closed := write(func(txn *Txn[int]) {
+		txn.Insert([]byte("other"), 60)
+		txn.Insert([]byte("zzz"), 70)
+	})
+	if fmt.Sprint(closed) != "[true false false false false]" {
+		t.Fatalf("bad: %v", closed)
+	}
+	_, closed = write(func(txn *Txn[int]) { txn.Insert([]byte("tenant.b.q"), 80) })
+	if fmt.Sprint(closed) != "[true true true false false]" {
+		t.Fatalf("bad: %v", closed)
+	}
+
+	// A key that diverges partway through a node still watches it, since a
+	// key on the path would split it.
+	values, watches = r.Root().PathWatch([]byte("tenant.a.svq"))
+	if len(values) != 3 || len(watches) != 5 {
+		t.Fatalf("bad: %d %d", len(values), len(watches))
+	}
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	txn.Insert([]byte("tenant.a.sv"), 90)
+	txn.Commit()
+	select {
+	case <-watches[4]:
+	default:
+		t.Fatalf("expected the split node's channel to close")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"", "a", "ab", "abc", "abd", "b", "ba", "c"} {
+		r, _, _ = r.Insert([]byte(k), i+1)
+	}
+
+	sum := func(acc int, _ []byte, v int) int { return acc + v }
+	concat := func(acc string, k []byte, _ int) string { return acc + string(k) + "," }
+	for _, prefix := range []string{"", "a", "ab", "abc", "abx", "b", "c", "d", "xyz"} {
+		var wantSum int
+		var wantKeys string
+		r.Root().WalkPrefix([]byte(prefix), func(k []byte, v int) bool {
+			wantSum += v
+			wantKeys += string(k) + ","
+			return false
+		})
+
+		if got := Collect(r.Root(), []byte(prefix), 0, sum); got != wantSum {
+			t.Fatalf("bad: %q: %d, expected %d", prefix, got, wantSum)
+		}
+		if got := Collect(r.Root(), []byte(prefix), "", concat); got != wantKeys {
+			t.Fatalf("bad: %q: %q, expected %q", prefix, got, wantKeys)
+		}
+	}
+
+	// The whole tree, and init coming back untouched when nothing matches.
+	if got := Collect(r.Root(), nil, 100, sum); got != 136 {
+		t.Fatalf("bad: %d", got)
+	}
+	if got := Collect(r.Root(), []byte("zz"), -1, sum); got != -1 {
+		t.Fatalf("bad: %d", got)
+	}
+	if got := Collect(New[int]().Root(), nil, "init", concat); got != "init" {
+		t.Fatalf("bad: %q", got)
+	}
+}
+
+func TestRange(t *testing.T) {
+	keys := []string{"", "a", "ab", "abc", "b", "ba", "bb", "c", "d"}
+	r := New[int]()
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	collect := func(lo, hi []byte, loInc, hiInc bool) string {
+		var out []string
+		for k, v := range r.Root().Range(lo, hi, loInc, hiInc) {
+			if keys[v] != string(k) {
+				t.Fatalf("bad: %q %d", k, v)
+			}
+			out = append(out, string(k))
+		}
+		return strings.Join(out, ",")
+	}
+
+	cases := []struct {
+		lo, hi       []byte
+		loInc, hiInc bool
+		expect       string
+	}{
+		// All four inclusivity combinations.
+		{[]byte("ab"), []byte("bb"), true, true, "ab,abc,b,ba,bb"},
+		{[]byte("ab"), []byte("bb"), true, false, "ab,abc,b,ba"},
+		{[]byte("ab"), []byte("bb"), false, true, "abc,b,ba,bb"},
+		{[]byte("ab"), []byte("bb"), false, false, "abc,b,ba"},
+
+		// Bounds that aren't keys.
+		{[]byte("aa"), []byte("bab"), false, false, "ab,abc,b,ba"},
+		{[]byte("aa"), []byte("bab"), true, true, "ab,abc,b,ba"},
+
+		// Unbounded sides.
+		{nil, []byte("ab"), false, true, ",a,ab"},
+		{nil, []byte("ab"), false, false, ",a"},
+		{[]byte("bb"), nil, false, false, "c,d"},
+		{nil, nil, false, false, ",a,ab,abc,b,ba,bb,c,d"},
+		{[]byte{}, nil, true, false, ",a,ab,abc,b,ba,bb,c,d"},
+		{[]byte{}, nil, false, false, "a,ab,abc,b,ba,bb,c,d"},
+
+		// Equal bounds.
+		{[]byte("b"), []byte("b"), true, true, "b"},
+		{[]byte("b"), []byte("b"), true, false, ""},
+		{[]byte("b"), []byte("b"), false, true, ""},
+		{[]byte("bc"), []byte("bc"), true, true, ""},
+
+		// Lo above hi.
+		{[]byte("c"), []byte("a"), true, true, ""},
+		{[]byte("zz"), nil, true, true, ""},
+	}
+	for _, c := range cases {
+		if got := collect(c.lo, c.hi, c.loInc, c.hiInc); got != c.expect {
+			t.Fatalf("bad: [%q %q %v %v]: %q, expected %q", c.lo, c.hi, c.loInc, c.hiInc, got, c.expect)
+		}
+	}
+
+	// Stopping early.
+	n := 0
+	for range r.Root().Range(nil, nil, true, true) {
+		if n++; n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestLeafNodes(t *testing.T) {
+	keys := []string{"", "foo", "foo/bar", "foo/baz", "foo/baz/qux", "foobar", "zip"}
+	r := New[int]()
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	for _, prefix := range []string{"", "foo", "foo/", "foo/baz", "fo", "z", "nope"} {
+		var want []string
+		r.Root().WalkPrefix([]byte(prefix), func(k []byte, v int) bool {
+			want = append(want, string(k))
+			return false
+		})
+
+		var got []string
+		for leaf := range r.Root().LeafNodes([]byte(prefix)) {
+			if !leaf.IsLeaf() {
+				t.Fatalf("bad: not a leaf")
+			}
+			k := leaf.LeafKey()
+			if !bytes.HasSuffix(k, leaf.Prefix()) {
+				t.Fatalf("bad: %q doesn't end in %q", k, leaf.Prefix())
+			}
+			if v, ok := leaf.LeafValue(); !ok || keys[v] != string(k) {
+				t.Fatalf("bad: %q %v %v", k, v, ok)
+			}
+			watch, _, _ := r.Root().GetWatch(k)
+			if leaf.LeafWatch() != watch {
+				t.Fatalf("bad: %q watch", k)
+			}
+			got = append(got, string(k))
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("bad: %q: %q, expected %q", prefix, got, want)
+		}
+	}
+
+	// Leaves stay as they were after the tree moves on.
+	var leaf *Node[int]
+	for l := range r.Root().LeafNodes([]byte("foo/bar")) {
+		leaf = l
+		break
+	}
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	txn.Insert([]byte("foo/bar"), 100)
+	txn.Commit()
+	select {
+	case <-leaf.LeafWatch():
+	default:
+		t.Fatalf("bad: watch not fired")
+	}
+	if v, _ := leaf.LeafValue(); v != 2 {
+		t.Fatalf("bad: %d", v)
+	}
+
+	// The accessors on a node that isn't a leaf.
+	n := New[int]().Root()
+	if n.IsLeaf() || n.LeafKey() != nil || n.LeafWatch() != nil || n.Prefix() != nil {
+		t.Fatalf("bad")
+	}
+	if _, ok := n.LeafValue(); ok {
+		t.Fatalf("bad")
+	}
+}
+
+func TestSample(t *testing.T) {
+	r := New[int]()
+	for i := 0; i < 20; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("m/%d", i)), i)
+	}
+	r, _, _ = r.Insert(nil, 20)
+
+	// Asking for everything, or more, returns every entry in order.
+	for _, k := range []int{r.Len(), r.Len() + 5} {
+		all := r.Root().Sample(k, rand.New(rand.NewSource(1)))
+		if len(all) != r.Len() {
+			t.Fatalf("bad: %d", len(all))
+		}
+		i := 0
+		r.Root().Walk(func(k []byte, v int) bool {
+			if !bytes.Equal(all[i].Key, k) || all[i].Value != v {
+				t.Fatalf("bad: %d %q", i, all[i].Key)
+			}
+			i++
+			return false
+		})
+	}
+	if got := r.Root().Sample(0, rand.New(rand.NewSource(1))); len(got) != 0 {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Each sample is distinct and sorted, and over many trials every entry
+	// comes up about equally often.
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[int]int)
+	const trials, k = 20000, 5
+	for i := 0; i < trials; i++ {
+		s := r.Root().Sample(k, rng)
+		if len(s) != k {
+			t.Fatalf("bad: %d", len(s))
+		}
+		for j := range s {
+			if j > 0 && bytes.Compare(s[j-1].Key, s[j].Key) >= 0 {
+				t.Fatalf("bad: %q before %q", s[j-1].Key, s[j].Key)
+			}
+			if v, ok := r.Get(s[j].Key); !ok || v != s[j].Value {
+				t.Fatalf("bad: %q", s[j].Key)
+			}
+			counts[s[j].Value]++
+		}
+	}
+	expect := trials * k / r.Len()
+	for v := 0; v < r.Len(); v++ {
+		if c := counts[v]; c < expect*9/10 || c > expect*11/10 {
+			t.Fatalf("bad: %d came up %d times, expected about %d", v, c, expect)
+		}
+	}
+
+	// The same seed gives the same sample.
+	a := r.Root().Sample(7, rand.New(rand.NewSource(42)))
+	b := r.Root().Sample(7, rand.New(rand.NewSource(42)))
+	for i := range a {
+		if !bytes.Equal(a[i].Key, b[i].Key) {
+			t.Fatalf("bad: %q != %q", a[i].Key, b[i].Key)
+		}
+	}
+}
+
+func TestPrefixHistogram(t *testing.T) {
+	keys := []string{
+		"t1.a.x", "t1.a.y", "t1.b", "t1",
+		"t2.a", "t2.a.b.c",
+		"t10.z.z",
+		"solo",
+		"",
+	}
+	r := New[int]()
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	cases := []struct {
+		depth  int
+		expect map[string]int
+	}{
+		{0, map[string]int{"": 9}},
+		{1, map[string]int{"": 1, "solo": 1, "t1": 4, "t2": 2, "t10": 1}},
+		{2, map[string]int{"": 1, "solo": 1, "t1": 1, "t1.a": 2, "t1.b": 1, "t2.a": 2, "t10.z": 1}},
+		{3, map[string]int{"": 1, "solo": 1, "t1": 1, "t1.a.x": 1, "t1.a.y": 1, "t1.b": 1, "t2.a": 1, "t2.a.b": 1, "t10.z.z": 1}},
+	}
+	for _, c := range cases {
+		got := r.Root().PrefixHistogram(c.depth, '.')
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("bad: %d: %v", c.depth, got)
+		}
+	}
+
+	// Deep enough, every key is its own bucket, and the counts always add up.
+	for depth := 1; depth < 6; depth++ {
+		total := 0
+		for _, c := range r.Root().PrefixHistogram(depth, '.') {
+			total += c
+		}
+		if total != r.Len() {
+			t.Fatalf("bad: %d: %d", depth, total)
+		}
+	}
+	if got := r.Root().PrefixHistogram(10, '.'); len(got) != len(keys) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	if got := New[int]().Root().PrefixHistogram(1, '.'); len(got) != 0 {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{
+		"acme.users.1", "acme.users.2", "acme.groups.1",
+		"beta.users.1",
+		"zeta", "zeta.users.1",
+		"acmex.users.1",
+	} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	firstSegment := func(k []byte) []byte {
+		if i := bytes.IndexByte(k, '.'); i >= 0 {
+			return k[:i]
+		}
+		return k
+	}
+
+	var got []string
+	r.Root().GroupBy(firstSegment, func(group []byte, items []KV[int]) bool {
+		var keys []string
+		for _, kv := range items {
+			if !bytes.Equal(firstSegment(kv.Key), group) {
+				t.Fatalf("bad: %q in group %q", kv.Key, group)
+			}
+			if v, _ := r.Get(kv.Key); v != kv.Value {
+				t.Fatalf("bad: %q %d", kv.Key, kv.Value)
+			}
+			keys = append(keys, string(kv.Key))
+		}
+		got = append(got, fmt.Sprintf("%s=%s", group, strings.Join(keys, ",")))
+		return true
+	})
+	expect := []string{
+		"acme=acme.groups.1,acme.users.1,acme.users.2",
+		"acmex=acmex.users.1",
+		"beta=beta.users.1",
+		"zeta=zeta,zeta.users.1",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad: %q", got)
+	}
+
+	// Stopping early.
+	calls := 0
+	r.Root().GroupBy(firstSegment, func(group []byte, items []KV[int]) bool {
+		calls++
+		return calls < 2
+	})
+	if calls != 2 {
+		t.Fatalf("bad: %d", calls)
+	}
+
+	// Nothing to group.
+	New[int]().Root().GroupBy(firstSegment, func([]byte, []KV[int]) bool {
+		t.Fatalf("bad")
+		return true
+	})
+}
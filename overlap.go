@@ -0,0 +1,216 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"sort"
+)
+
+// OverlapKind describes how one wildcard pattern overlaps another.
+type OverlapKind int
+
+const (
+	// OverlapDuplicate means the two patterns are the same.
+	OverlapDuplicate OverlapKind = iota
+
+	// OverlapShadowed means a wildcard pattern only matches keys that a
+	// broader wildcard pattern also matches, such as "a.b.*" under "a.*".
+	OverlapShadowed
+
+	// OverlapRedundant means an exact key is also matched by a wildcard
+	// pattern, such as "a.b" under "a.*".
+	OverlapRedundant
+)
+
+func (k OverlapKind) String() string {
+	switch k {
+	case OverlapDuplicate:
+		return "duplicate"
+	case OverlapShadowed:
+		return "shadowed"
+	case OverlapRedundant:
+		return "redundant"
+	default:
+		return "unknown"
+	}
+}
+
+// OverlapReport describes a pair of overlapping patterns, where Covering
+// matches every key that Pattern does.
+type OverlapReport struct {
+	Pattern  []byte
+	Covering []byte
+	Kind     OverlapKind
+
+	// PatternInTree and CoveringInTree are set for whichever of the pair
+	// was already in the tree, rather than in the new batch.
+	PatternInTree  bool
+	CoveringInTree bool
+}
+
+// AnalyzeWildcardOverlaps reports the overlaps that adding the given batch of
+// patterns to the tree would cause, using the same dot-separated rules as
+// MatchWithWildcards. Each pattern in the batch is checked against the rest of
+// the batch and against the tree, in both directions, but overlaps that are
+// already within the tree aren't reported. A pattern is reported once for
+// each pattern that covers it, so under "*" every other key is reported. The
+// reports are sorted by Pattern and then Covering. Keys inserted with
+// InsertLiteral are treated as exact keys.
+//
+// The batch is first loaded into a scratch tree, so each pattern only needs a
+// lookup per segment to find the patterns that cover it, and a walk of its
+// prefix in the tree to find the keys that it covers.
+func (n *Node[T]) AnalyzeWildcardOverlaps(newPatterns [][]byte) []OverlapReport {
+	var reports []OverlapReport
+
+	txn := New[struct{}]().Txn()
+	for _, p := range newPatterns {
+		if _, dup := txn.Insert(p, struct{}{}); dup {
+			reports = append(reports, OverlapReport{Pattern: p, Covering: p, Kind: OverlapDuplicate})
+		}
+	}
+	batch := txn.Commit().Root()
+
+	batch.Walk(func(p []byte, _ struct{}) bool {
+		// A literal key in the tree is only the same as an exact key.
+		if leaf := n.getLeaf(p); leaf != nil && (isPattern(leaf) || !isWildcardPattern(p)) {
+			reports = append(reports, OverlapReport{Pattern: p, Covering: p, Kind: OverlapDuplicate, CoveringInTree: true})
+		}
+
+		// Look for the patterns that cover this one, in the batch and in
+		// the tree.
+		kind := overlapKind(p)
+		for _, c := range coveringPatterns(p) {
+			if _, ok := batch.Get(c); ok {
+				reports = append(reports, OverlapReport{Pattern: p, Covering: c, Kind: kind})
+			}
+			if isPattern(n.getLeaf(c)) {
+				reports = append(reports, OverlapReport{Pattern: p, Covering: c, Kind: kind, CoveringInTree: true})
+			}
+		}
+
+		// If this is a wildcard, look for the keys in the tree that it
+		// covers.
+		covered := func(k []byte, leaf *leafNode[T]) {
+			if bytes.Equal(k, p) && isPattern(leaf) {
+				return
+			}
+			kind := OverlapRedundant
+			if isPattern(leaf) && isWildcardPattern(k) {
+				kind = OverlapShadowed
+			}
+			reports = append(reports, OverlapReport{Pattern: k, Covering: p, Kind: kind, PatternInTree: true})
+		}
+		switch {
+		case bytes.Equal(p, []byte("*")):
+			walkLeaves(n, func(leaf *leafNode[T]) {
+				if len(leaf.key) > 0 {
+					covered(leaf.key, leaf)
+				}
+			})
+		case isWildcardPattern(p):
+			// The wildcard matches the key before the ".*", but not a
+			// pattern like it.
+			base := p[:len(p)-2]
+			if leaf := n.getLeaf(base); leaf != nil && !(isPattern(leaf) && isWildcardPattern(base)) {
+				covered(base, leaf)
+			}
+			if pn := n.prefixNode(p[:len(p)-1]); pn != nil {
+				walkLeaves(pn, func(leaf *leafNode[T]) {
+					covered(leaf.key, leaf)
+				})
+			}
+		}
+		return false
+	})
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		if c := bytes.Compare(reports[i].Pattern, reports[j].Pattern); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(reports[i].Covering, reports[j].Covering) < 0
+	})
+	return reports
+}
+
+// CompactWildcardRedundant deletes the exact keys that a wildcard pattern in
+// the transaction already matches with an equal value, according to eq,
+// returning the number of keys deleted. Only the most specific pattern that
+// matches a key is compared, since that's the one MatchWithRemainder would
+// find once the key is gone, so a key is kept if it's covered by "a.*" with
+// the same value but by "a.b.*" with a different one. Keys inserted with
+// InsertLiteral that look like patterns, and the empty key, which no pattern
+// matches, are always kept. The keys to delete are gathered before any are
+// deleted, and this visits every leaf.
+func (t *Txn[T]) CompactWildcardRedundant(eq func(a, b T) bool) int {
+	t.checkUsable()
+	var doomed [][]byte
+	walkLeaves(t.root, func(leaf *leafNode[T]) {
+		if len(leaf.key) == 0 || isWildcardPattern(leaf.key) {
+			return
+		}
+		covering := coveringPatterns(leaf.key)
+		for i := len(covering) - 1; i >= 0; i-- {
+			if c := t.root.getLeaf(covering[i]); isPattern(c) {
+				if eq(leaf.val, c.val) {
+					doomed = append(doomed, leaf.key)
+				}
+				return
+			}
+		}
+	})
+	for _, k := range doomed {
+		t.Delete(k)
+	}
+	return len(doomed)
+}
+
+// isWildcardPattern returns true if p is a wildcard pattern under the rules of
+// MatchWithWildcards, either "*" or ending in ".*".
+func isWildcardPattern(p []byte) bool {
+	return bytes.Equal(p, []byte("*")) || bytes.HasSuffix(p, []byte(".*"))
+}
+
+// overlapKind returns the kind of overlap for the pattern p being covered by
+// a different pattern.
+func overlapKind(p []byte) OverlapKind {
+	if isWildcardPattern(p) {
+		return OverlapShadowed
+	}
+	return OverlapRedundant
+}
+
+// coveringPatterns returns the other wildcard patterns that would match every
+// key that p does, from the broadest to the narrowest.
+func coveringPatterns(p []byte) [][]byte {
+	if len(p) == 0 || bytes.Equal(p, []byte("*")) {
+		return nil
+	}
+
+	out := [][]byte{[]byte("*")}
+	base, wild := p, isWildcardPattern(p)
+	if wild {
+		base = p[:len(p)-2]
+	}
+	for i, b := range base {
+		if b == '.' {
+			out = append(out, concat(base[:i], []byte(".*")))
+		}
+	}
+	if !wild {
+		out = append(out, concat(base, []byte(".*")))
+	}
+	return out
+}
+
+// walkLeaves calls fn for each leaf under n, in key order.
+func walkLeaves[T any](n *Node[T], fn func(leaf *leafNode[T])) {
+	if n.leaf != nil {
+		fn(n.leaf)
+	}
+	for _, e := range n.edges {
+		walkLeaves(e.node, fn)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeWildcardOverlaps(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"tenant.a.*", "tenant.b.read", "svc.*", "plain"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), 9)
+
+	format := func(reports []OverlapReport) []string {
+		out := []string{}
+		for _, o := range reports {
+			where := func(in bool) string {
+				if in {
+					return "tree"
+				}
+				return "new"
+			}
+			out = append(out, fmt.Sprintf("%s(%s) %s by %s(%s)",
+				o.Pattern, where(o.PatternInTree), o.Kind, o.Covering, where(o.CoveringInTree)))
+		}
+		return out
+	}
+
+	cases := []struct {
+		name  string
+		batch []string
+		out   []string
+	}{
+		{
+			"no overlaps",
+			[]string{"other.*", "tenant.c.read", "plainer"},
+			[]string{},
+		},
+		{
+			"duplicates",
+			[]string{"svc.*", "x.y", "x.y", "plain"},
+			[]string{
+				"plain(new) duplicate by plain(tree)",
+				"svc.*(new) duplicate by svc.*(tree)",
+				"x.y(new) duplicate by x.y(new)",
+			},
+		},
+		{
+			"a wildcard in the tree covers new patterns",
+			[]string{"svc.api.*", "svc.api.read", "svc", "svcs.x", "tenant.a"},
+			[]string{
+				"svc(new) redundant by svc.*(tree)",
+				"svc.api.*(new) shadowed by svc.*(tree)",
+				"svc.api.read(new) redundant by svc.*(tree)",
+				"svc.api.read(new) redundant by svc.api.*(new)",
+				"tenant.a(new) redundant by tenant.a.*(tree)",
+			},
+		},
+		{
+			"a new wildcard covers patterns in the tree",
+			[]string{"tenant.*"},
+			[]string{
+				"tenant.a.*(tree) shadowed by tenant.*(new)",
+				"tenant.b.read(tree) redundant by tenant.*(new)",
+			},
+		},
+		{
+			"literal keys are only exact keys",
+			[]string{"lit.*", "lit.x"},
+			[]string{
+				"lit.*(tree) redundant by lit.*(new)",
+				"lit.x(new) redundant by lit.*(new)",
+			},
+		},
+		{
+			"the universal wildcard covers everything",
+			[]string{"*", "new.key"},
+			[]string{
+				"lit.*(tree) redundant by *(new)",
+				"new.key(new) redundant by *(new)",
+				"plain(tree) redundant by *(new)",
+				"svc.*(tree) shadowed by *(new)",
+				"tenant.a.*(tree) shadowed by *(new)",
+				"tenant.b.read(tree) redundant by *(new)",
+			},
+		},
+	}
+	for _, c := range cases {
+		var batch [][]byte
+		for _, p := range c.batch {
+			batch = append(batch, []byte(p))
+		}
+		got := format(r.Root().AnalyzeWildcardOverlaps(batch))
+		if !reflect.DeepEqual(got, c.out) {
+			t.Fatalf("bad: %s: %q", c.name, got)
+		}
+	}
+
+	// Every redundant key is really matched by the pattern that covers it.
+	batch := [][]byte{[]byte("a.*"), []byte("a.b"), []byte("a.b.*"), []byte("a.b.c"), []byte("a"), []byte("*")}
+	for _, o := range New[int]().Root().AnalyzeWildcardOverlaps(batch) {
+		if o.Kind != OverlapRedundant {
+			continue
+		}
+		single, _, _ := New[int]().Insert(o.Covering, 0)
+		if !single.Root().MatchWithWildcards(o.Pattern) {
+			t.Fatalf("bad: %q doesn't match %q", o.Covering, o.Pattern)
+		}
+	}
+}
+
+func TestCompactWildcardRedundant(t *testing.T) {
+	r := New[string]()
+	for k, v := range map[string]string{
+		"*":            "deny",
+		"tenant.*":     "read",
+		"tenant.abc.*": "write",
+
+		"tenant.x":          "read",  // covered by tenant.* and equal
+		"tenant.y":          "write", // covered by tenant.* but different
+		"tenant.abc":        "write", // covered by tenant.abc.* and equal
+		"tenant.abc.p.q":    "read",  // equal to tenant.* but tenant.abc.* is closer
+		"tenant.abc.p.r":    "write", // equal to the closest pattern
+		"other":             "deny",  // only covered by *
+		"other.thing":       "allow", // only covered by * and different
+		"":                  "deny",  // never matched by a pattern
+		"tenant.abc.prefix": "write",
+	} {
+		r, _, _ = r.Insert([]byte(k), v)
+	}
+	r, _, _ = r.InsertLiteral([]byte("tenant.lit.*"), "read")
+	r, _, _ = r.InsertLiteral([]byte("tenant.lit"), "read")
+
+	txn := r.Txn()
+	eq := func(a, b string) bool { return a == b }
+	if n := txn.CompactWildcardRedundant(eq); n != 6 {
+		t.Fatalf("bad: %d", n)
+	}
+	r2 := txn.Commit()
+	checkSizes(t, r2.Root())
+
+	var kept []string
+	r2.Root().Walk(func(k []byte, _ string) bool {
+		kept = append(kept, string(k))
+		return false
+	})
+	expect := []string{"", "*", "other.thing", "tenant.*", "tenant.abc.*", "tenant.abc.p.q", "tenant.lit.*", "tenant.y"}
+	if !reflect.DeepEqual(kept, expect) {
+		t.Fatalf("bad: %q", kept)
+	}
+
+	// Every key in the original tree still resolves to the same value.
+	r.Root().Walk(func(k []byte, v string) bool {
+		_, _, got, ok := r2.Root().MatchWithRemainder(k)
+		if !ok || got != v {
+			t.Fatalf("bad: %q: %q %v, expected %q", k, got, ok, v)
+		}
+		return false
+	})
+
+	// Nothing left to compact.
+	txn = r2.Txn()
+	if n := txn.CompactWildcardRedundant(eq); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// PatternSet is an immutable set of wildcard patterns, kept apart from the data
+// they're matched against. Patterns have the same meaning as they do for
+// MatchWithWildcards. Since the set is fixed when it's built, facts about it
+// such as whether it holds the universal wildcard are worked out once up front
+// instead of on every match. A PatternSet is safe for concurrent use.
+type PatternSet struct {
+	tree *Tree[struct{}]
+
+	// universal is the leaf for the universal wildcard "*", or nil if the
+	// set doesn't have one.
+	universal *leafNode[struct{}]
+}
+
+// NewPatternSet returns a set holding the given patterns. The patterns are
+// copied, so the caller is free to reuse the slices afterwards. Duplicates are
+// ignored.
+func NewPatternSet(patterns [][]byte) *PatternSet {
+	txn := New[struct{}]().Txn()
+	for _, p := range patterns {
+		k := make([]byte, len(p))
+		copy(k, p)
+		txn.Insert(k, struct{}{})
+	}
+	s := &PatternSet{tree: txn.Commit()}
+	s.universal = s.tree.root.getLeaf([]byte("*"))
+	return s
+}
+
+// Len returns the number of distinct patterns in the set.
+func (s *PatternSet) Len() int {
+	return s.tree.Len()
+}
+
+// Match returns the most specific pattern in the set that matches the key, and
+// whether there was any match at all. This matches exactly when
+// MatchWithWildcards would for a tree holding the same patterns. An exact
+// match is the most specific, then the longest pattern ending in ".*", and
+// then the universal wildcard "*". The returned pattern must not be modified.
+func (s *PatternSet) Match(key []byte) (pattern []byte, ok bool) {
+	universal := s.universal
+	if len(key) == 0 {
+		universal = nil
+	}
+	if l := s.tree.root.bestWildcardMatch(key, dotSep, universal); l != nil {
+		return l.key, true
+	}
+	return nil, false
+}
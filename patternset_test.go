@@ -0,0 +1,127 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// bruteForceWildcardMatch returns the most specific of the given patterns
+// that matches the key, following the rules for MatchWithWildcards.
+func bruteForceWildcardMatch(patterns [][]byte, key []byte) ([]byte, bool) {
+	var best []byte
+	found := false
+	for _, p := range patterns {
+		if bytes.Equal(p, key) {
+			return p, true
+		}
+	}
+	if len(key) == 0 {
+		return nil, false
+	}
+	for _, p := range patterns {
+		switch {
+		case bytes.Equal(p, []byte("*")):
+			if len(key) > 0 && !found {
+				best, found = p, true
+			}
+		case bytes.HasSuffix(p, []byte(".*")):
+			base := p[:len(p)-2]
+			if bytes.Equal(key, base) || bytes.HasPrefix(key, p[:len(p)-1]) {
+				if !found || len(p) > len(best) || bytes.Equal(best, []byte("*")) {
+					best, found = p, true
+				}
+			}
+		}
+	}
+	return best, found
+}
+
+func TestPatternSet(t *testing.T) {
+	patterns := [][]byte{
+		[]byte("tenant.*"),
+		[]byte("tenant.abc.*"),
+		[]byte("tenant.abc.project.x"),
+		[]byte("other.*"),
+	}
+	s := NewPatternSet(patterns)
+	if s.Len() != 4 {
+		t.Fatalf("bad: %d", s.Len())
+	}
+
+	// The set doesn't depend on the caller's slices.
+	patterns[0][0] = 'X'
+
+	cases := map[string]string{
+		"tenant.abc.project.x": "tenant.abc.project.x",
+		"tenant.abc.project.y": "tenant.abc.*",
+		"tenant.abc":           "tenant.abc.*",
+		"tenant.xyz":           "tenant.*",
+		"tenant":               "tenant.*",
+		"other.a.b":            "other.*",
+		"nope":                 "",
+		"":                     "",
+	}
+	for key, want := range cases {
+		got, ok := s.Match([]byte(key))
+		if string(got) != want || ok != (want != "") {
+			t.Fatalf("bad: %q got %q %v want %q", key, got, ok, want)
+		}
+	}
+
+	// The universal wildcard is the last resort.
+	s = NewPatternSet([][]byte{[]byte("*"), []byte("a.*")})
+	if got, _ := s.Match([]byte("a.b")); string(got) != "a.*" {
+		t.Fatalf("bad: %q", got)
+	}
+	if got, _ := s.Match([]byte("b")); string(got) != "*" {
+		t.Fatalf("bad: %q", got)
+	}
+	if _, ok := s.Match(nil); ok {
+		t.Fatalf("universal wildcard matched the empty key")
+	}
+}
+
+func TestPatternSet_Equivalence(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab.*"
+		b := make([]byte, rnd.Intn(7))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 1000; round++ {
+		var patterns [][]byte
+		r := New[bool]()
+		for i := 0; i < rnd.Intn(12)+1; i++ {
+			p := randKey()
+			if rnd.Intn(4) == 0 {
+				p = append(p, ".*"...)
+			}
+			patterns = append(patterns, p)
+			r, _, _ = r.Insert(p, true)
+		}
+		s := NewPatternSet(patterns)
+
+		for i := 0; i < 50; i++ {
+			key := randKey()
+			got, ok := s.Match(key)
+			if node := r.Root().MatchWithWildcards(key); ok != node {
+				t.Fatalf("mis-match with node: %q in %q got %v want %v", key, patterns, ok, node)
+			}
+			if p, _, _, rok := r.Root().MatchWithRemainder(key); rok != ok || !bytes.Equal(p, got) {
+				t.Fatalf("mis-match with remainder: %q in %q got %q %v want %q %v", key, patterns, p, rok, got, ok)
+			}
+			want, wantOK := bruteForceWildcardMatch(patterns, key)
+			if ok != wantOK || !bytes.Equal(got, want) {
+				t.Fatalf("mis-match: %q in %q got %q %v want %q %v", key, patterns, got, ok, want, wantOK)
+			}
+		}
+	}
+}
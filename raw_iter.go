@@ -79,3 +79,14 @@ func (i *rawIterator[T]) Next() {
 	i.pos = nil
 	i.path = ""
 }
+
+// skipSubtree advances the iterator past all the descendants of the current
+// node, moving to the next node that isn't beneath it.
+func (i *rawIterator[T]) skipSubtree() {
+	// Next pushes the children of the current node onto the frontier right
+	// before it returns, so they are at the top of the stack if present.
+	if i.pos != nil && len(i.pos.edges) > 0 {
+		i.stack = i.stack[:len(i.stack)-1]
+	}
+	i.Next()
+}
@@ -0,0 +1,91 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// ReadOnly is a read-only view of a Tree. It exposes the lookup, iteration and
+// watch operations of the tree but has no way to start a transaction or to
+// insert or delete keys, which makes it suitable for handing a tree to code
+// that should only ever observe it. The tree is immutable in any case, so this
+// is purely about restricting the API that's available to the holder.
+type ReadOnly[T any] struct {
+	tree *Tree[T]
+}
+
+// AsReadOnly returns a read-only view of the tree.
+func (t *Tree[T]) AsReadOnly() ReadOnly[T] {
+	return ReadOnly[T]{tree: t}
+}
+
+// Len is used to return the number of elements in the tree
+func (r ReadOnly[T]) Len() int {
+	return r.tree.Len()
+}
+
+// Root returns the root node of the tree which can be used for richer
+// query operations. Nodes only expose read operations.
+func (r ReadOnly[T]) Root() *Node[T] {
+	return r.tree.root
+}
+
+// Get is used to lookup a specific key, returning
+// the value and if it was found
+func (r ReadOnly[T]) Get(k []byte) (T, bool) {
+	return r.tree.root.Get(k)
+}
+
+// GetWatch is used to lookup a specific key, returning
+// the watch channel, value and if it was found
+func (r ReadOnly[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
+	return r.tree.root.GetWatch(k)
+}
+
+// LongestPrefix is like Get, but instead of an
+// exact match, it will return the longest prefix match.
+func (r ReadOnly[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
+	return r.tree.root.LongestPrefix(k)
+}
+
+// Minimum is used to return the minimum value in the tree
+func (r ReadOnly[T]) Minimum() ([]byte, T, bool) {
+	return r.tree.root.Minimum()
+}
+
+// Maximum is used to return the maximum value in the tree
+func (r ReadOnly[T]) Maximum() ([]byte, T, bool) {
+	return r.tree.root.Maximum()
+}
+
+// Iterator is used to return an iterator over the tree. Its
+// SeekPrefixWatch method can be used to watch a subtree.
+func (r ReadOnly[T]) Iterator() *Iterator[T] {
+	return r.tree.root.Iterator()
+}
+
+// ReverseIterator is used to return an iterator to walk the tree
+// backwards
+func (r ReadOnly[T]) ReverseIterator() *ReverseIterator[T] {
+	return r.tree.root.ReverseIterator()
+}
+
+// Walk is used to walk the tree
+func (r ReadOnly[T]) Walk(fn WalkFn[T]) {
+	r.tree.root.Walk(fn)
+}
+
+// WalkPrefix is used to walk the tree under a prefix
+func (r ReadOnly[T]) WalkPrefix(prefix []byte, fn WalkFn[T]) {
+	r.tree.root.WalkPrefix(prefix, fn)
+}
+
+// WalkPath is used to walk the tree, but only visiting nodes
+// from the root down to a given leaf.
+func (r ReadOnly[T]) WalkPath(path []byte, fn WalkFn[T]) {
+	r.tree.root.WalkPath(path, fn)
+}
+
+// MatchWithWildcards checks if a key matches any pattern in the tree,
+// see Node.MatchWithWildcards.
+func (r ReadOnly[T]) MatchWithWildcards(key []byte) bool {
+	return r.tree.root.MatchWithWildcards(key)
+}
@@ -0,0 +1,92 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"foo", "foo.bar", "foo.baz", "tenant.*"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	ro := r.AsReadOnly()
+
+	// None of the mutation entry points are available on the view.
+	var view any = ro
+	if _, ok := view.(interface{ Txn() *Txn[int] }); ok {
+		t.Fatalf("read-only view exposes Txn")
+	}
+	if _, ok := view.(interface {
+		Insert([]byte, int) (*Tree[int], int, bool)
+	}); ok {
+		t.Fatalf("read-only view exposes Insert")
+	}
+	if _, ok := view.(interface {
+		Delete([]byte) (*Tree[int], int, bool)
+	}); ok {
+		t.Fatalf("read-only view exposes Delete")
+	}
+	if _, ok := view.(interface {
+		DeletePrefix([]byte) (*Tree[int], bool)
+	}); ok {
+		t.Fatalf("read-only view exposes DeletePrefix")
+	}
+
+	if ro.Len() != 4 {
+		t.Fatalf("bad len: %d", ro.Len())
+	}
+	if v, ok := ro.Get([]byte("foo.bar")); !ok || v != 1 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+	if m, _, ok := ro.LongestPrefix([]byte("foo.bazzz")); !ok || string(m) != "foo.baz" {
+		t.Fatalf("bad: %q %v", m, ok)
+	}
+	if !ro.MatchWithWildcards([]byte("tenant.abc")) || ro.MatchWithWildcards([]byte("other")) {
+		t.Fatalf("bad wildcard match")
+	}
+	var out []string
+	ro.WalkPrefix([]byte("foo."), func(k []byte, _ int) bool {
+		out = append(out, string(k))
+		return false
+	})
+	if len(out) != 2 {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// Watches taken through the view fire when the tree changes.
+	leafWatch, _, _ := ro.GetWatch([]byte("foo.bar"))
+	prefixWatch := ro.Iterator().SeekPrefixWatch([]byte("foo."))
+	otherWatch, _, _ := ro.GetWatch([]byte("tenant.*"))
+
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	txn.Insert([]byte("foo.bar"), 42)
+	r = txn.Commit()
+
+	select {
+	case <-leafWatch:
+	default:
+		t.Fatalf("leaf watch didn't fire")
+	}
+	select {
+	case <-prefixWatch:
+	default:
+		t.Fatalf("prefix watch didn't fire")
+	}
+	select {
+	case <-otherWatch:
+		t.Fatalf("unrelated watch fired")
+	default:
+	}
+
+	// The old view still sees the old snapshot.
+	if v, _ := ro.Get([]byte("foo.bar")); v != 1 {
+		t.Fatalf("bad: %v", v)
+	}
+	if v, _ := r.AsReadOnly().Get([]byte("foo.bar")); v != 42 {
+		t.Fatalf("bad: %v", v)
+	}
+}
@@ -183,7 +183,8 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 	}
 }
 
-// Previous returns the previous node in reverse order
+// Previous returns the previous node in reverse order. Returned keys have
+// the same lifetime guarantees as those returned by Iterator.Next.
 func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 	// Initialize our stack if needed
 	if ri.i.stack == nil && ri.i.node != nil {
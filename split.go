@@ -0,0 +1,148 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Split returns two trees, one with all of the keys that sort before the given
+// key, and one with all of the keys that sort at or after it, so the key
+// itself goes to the right. The original tree is unchanged, and both halves
+// share all of its structure except for the nodes on the path to the key.
+func (t *Tree[T]) Split(key []byte) (left, right *Tree[T]) {
+	l, r := splitNode(t.root, key, 0)
+	lr, rr := asRoot(l), asRoot(r)
+	return &Tree[T]{lr, lr.size}, &Tree[T]{rr, rr.size}
+}
+
+// splitNode splits the subtree under n into the keys before key and the keys
+// at or after it, either of which may be nil if there are none. The path to n
+// must be key[:depth].
+func splitNode[T any](n *Node[T], key []byte, depth int) (*Node[T], *Node[T]) {
+	// Everything under n starts with the key, so nothing is before it.
+	if len(key) == depth {
+		return nil, n
+	}
+
+	// n's own leaf is a proper prefix of the key, so it's before it.
+	left := &Node[T]{
+		mutateCh: make(chan struct{}),
+		prefix:   n.prefix,
+		leaf:     n.leaf,
+	}
+	right := &Node[T]{
+		mutateCh: make(chan struct{}),
+		prefix:   n.prefix,
+	}
+	for _, e := range n.edges {
+		// Compare the child's prefix with the same span of the key, which
+		// puts the whole subtree on one side unless they're equal. If the
+		// key runs out first, the child's keys are all longer so come after.
+		rest := key[depth:]
+		cmp := bytes.Compare(e.node.prefix, rest[:min(len(rest), len(e.node.prefix))])
+		switch {
+		case cmp < 0:
+			left.edges = append(left.edges, e)
+		case cmp > 0:
+			right.edges = append(right.edges, e)
+		default:
+			l, r := splitNode(e.node, key, depth+len(e.node.prefix))
+			if l != nil {
+				left.edges = append(left.edges, edge[T]{label: e.label, node: l})
+			}
+			if r != nil {
+				right.edges = append(right.edges, edge[T]{label: e.label, node: r})
+			}
+		}
+	}
+	return subsetNode(n, left), subsetNode(n, right)
+}
+
+// ErrOverlappingRanges is returned by Join when the trees' key ranges overlap.
+var ErrOverlappingRanges = errors.New("trees have overlapping key ranges")
+
+// Join returns the union of two trees where every key in left sorts before
+// every key in right, such as the two halves from Split. Rather than inserting
+// one tree's keys into the other, it builds only the nodes where the largest
+// keys of left meet the smallest keys of right, and shares the rest of both
+// trees. If the key ranges overlap it returns ErrOverlappingRanges; use a
+// transaction to merge trees like that.
+func Join[T any](left, right *Tree[T]) (*Tree[T], error) {
+	if left.size == 0 {
+		return right, nil
+	}
+	if right.size == 0 {
+		return left, nil
+	}
+	maxLeft, _, _ := left.root.Maximum()
+	minRight, _, _ := right.root.Minimum()
+	if bytes.Compare(maxLeft, minRight) >= 0 {
+		return nil, ErrOverlappingRanges
+	}
+	root := joinNodes(left.root, right.root)
+	return &Tree[T]{root, root.size}, nil
+}
+
+// joinNodes returns the union of the subtrees under a and b, which must not
+// have any keys in common. The nodes must be at the same depth, and their
+// prefixes must start with the same byte unless they are both roots.
+func joinNodes[T any](a, b *Node[T]) *Node[T] {
+	// Split off whichever prefix goes further than the common part, so that
+	// both nodes are for the same path.
+	c := longestPrefix(a.prefix, b.prefix)
+	a, b = splitPrefix(a, c), splitPrefix(b, c)
+
+	nc := &Node[T]{
+		mutateCh: make(chan struct{}),
+		prefix:   a.prefix,
+		leaf:     a.leaf,
+		size:     a.size + b.size,
+	}
+	if nc.leaf == nil {
+		nc.leaf = b.leaf
+	}
+	i, j := 0, 0
+	for i < len(a.edges) || j < len(b.edges) {
+		switch {
+		case j == len(b.edges) || (i < len(a.edges) && a.edges[i].label < b.edges[j].label):
+			nc.edges = append(nc.edges, a.edges[i])
+			i++
+		case i == len(a.edges) || b.edges[j].label < a.edges[i].label:
+			nc.edges = append(nc.edges, b.edges[j])
+			j++
+		default:
+			nc.edges = append(nc.edges, edge[T]{
+				label: a.edges[i].label,
+				node:  joinNodes(a.edges[i].node, b.edges[j].node),
+			})
+			i++
+			j++
+		}
+	}
+	return nc
+}
+
+// splitPrefix returns n if its prefix is c bytes long, or else a new node with
+// the first c bytes of the prefix whose only child is a copy of n with the
+// rest.
+func splitPrefix[T any](n *Node[T], c int) *Node[T] {
+	if len(n.prefix) == c {
+		return n
+	}
+	child := &Node[T]{
+		mutateCh: make(chan struct{}),
+		prefix:   n.prefix[c:],
+		leaf:     n.leaf,
+		edges:    n.edges,
+		size:     n.size,
+	}
+	return &Node[T]{
+		mutateCh: make(chan struct{}),
+		prefix:   n.prefix[:c],
+		edges:    edges[T]{{label: child.prefix[0], node: child}},
+		size:     n.size,
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTreeSplit(t *testing.T) {
+	r := New[int]()
+	keys := []string{"", "a", "ab", "abc", "abd", "b", "ba", "bb", "c"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	treeKeys := func(tr *Tree[int]) []string {
+		out := []string{}
+		tr.Root().Walk(func(k []byte, _ int) bool {
+			out = append(out, string(k))
+			return false
+		})
+		return out
+	}
+
+	cases := []struct {
+		key   string
+		left  int
+		right int
+	}{
+		{"", 0, 9},
+		{"a", 1, 8},
+		{"ab", 2, 7},
+		{"abb", 3, 6},
+		{"abc", 3, 6},
+		{"abcd", 4, 5},
+		{"b", 5, 4},
+		{"bab", 7, 2},
+		{"d", 9, 0},
+	}
+	for _, c := range cases {
+		left, right := r.Split([]byte(c.key))
+		if left.Len() != c.left || right.Len() != c.right {
+			t.Fatalf("bad: %q: %d %d", c.key, left.Len(), right.Len())
+		}
+		lk, rk := treeKeys(left), treeKeys(right)
+		if !reflect.DeepEqual(lk, keys[:c.left]) || !reflect.DeepEqual(rk, keys[c.left:]) {
+			t.Fatalf("bad: %q: %v %v", c.key, lk, rk)
+		}
+		checkCanonical(t, left.Root())
+		checkCanonical(t, right.Root())
+		checkSizes(t, left.Root())
+		checkSizes(t, right.Root())
+	}
+
+	// Splitting off nothing shares the whole tree.
+	if _, right := r.Split(nil); right.Root() != r.Root() {
+		t.Fatalf("expected the original root")
+	}
+	if left, _ := r.Split([]byte("d")); left.Root() != r.Root() {
+		t.Fatalf("expected the original root")
+	}
+
+	// The halves are ordinary trees.
+	left, right := r.Split([]byte("b"))
+	left, _, _ = left.Insert([]byte("zzz"), 99)
+	if left.Len() != 6 || right.Len() != 4 || r.Len() != 9 {
+		t.Fatalf("bad: %d %d %d", left.Len(), right.Len(), r.Len())
+	}
+	if _, ok := r.Get([]byte("zzz")); ok {
+		t.Fatalf("original was modified")
+	}
+
+	// An empty tree splits into two empty trees.
+	left, right = New[int]().Split([]byte("a"))
+	if left.Len() != 0 || right.Len() != 0 {
+		t.Fatalf("bad: %d %d", left.Len(), right.Len())
+	}
+}
+
+func TestTreeSplit_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab/"
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 200; round++ {
+		r := New[int]()
+		for i := 0; i < rnd.Intn(30); i++ {
+			r, _, _ = r.Insert(randKey(), i)
+		}
+
+		key := randKey()
+		left, right := r.Split(key)
+		if left.Len()+right.Len() != r.Len() {
+			t.Fatalf("bad: %d + %d != %d", left.Len(), right.Len(), r.Len())
+		}
+		checkCanonical(t, left.Root())
+		checkCanonical(t, right.Root())
+		checkSizes(t, left.Root())
+		checkSizes(t, right.Root())
+
+		// Putting the halves back together gives the original.
+		txn := left.Txn()
+		right.Root().Walk(func(k []byte, v int) bool {
+			if bytes.Compare(k, key) < 0 {
+				t.Fatalf("bad: %q is before %q", k, key)
+			}
+			txn.Insert(k, v)
+			return false
+		})
+		left.Root().Walk(func(k []byte, _ int) bool {
+			if bytes.Compare(k, key) >= 0 {
+				t.Fatalf("bad: %q is not before %q", k, key)
+			}
+			return false
+		})
+		merged := txn.Commit()
+		if merged.Len() != r.Len() {
+			t.Fatalf("bad: %d", merged.Len())
+		}
+		r.Root().Walk(func(k []byte, v int) bool {
+			if got, ok := merged.Get(k); !ok || got != v {
+				t.Fatalf("bad: %q: %d %v", k, got, ok)
+			}
+			return false
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	build := func(keys ...string) *Tree[int] {
+		r := New[int]()
+		for i, k := range keys {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		return r
+	}
+
+	left := build("", "a", "ab", "abc")
+	right := build("abd", "abda", "b", "c")
+	j, err := Join(left, right)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if j.Len() != 8 {
+		t.Fatalf("bad: %d", j.Len())
+	}
+	var keys []string
+	j.Root().Walk(func(k []byte, _ int) bool {
+		keys = append(keys, string(k))
+		return false
+	})
+	if !reflect.DeepEqual(keys, []string{"", "a", "ab", "abc", "abd", "abda", "b", "c"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+	checkCanonical(t, j.Root())
+	checkSizes(t, j.Root())
+
+	// Subtrees away from where the two meet are shared.
+	_, cNode := right.Root().getEdge('c')
+	_, jNode := j.Root().getEdge('c')
+	if cNode != jNode {
+		t.Fatalf("expected the right tree's node to be shared")
+	}
+
+	// Overlapping or touching ranges are refused.
+	for _, r := range []*Tree[int]{build("abc"), build("aa", "z"), build("")} {
+		if _, err := Join(left, r); err != ErrOverlappingRanges {
+			t.Fatalf("bad: %v", err)
+		}
+	}
+
+	// Empty trees join trivially.
+	if j, err := Join(New[int](), right); err != nil || j != right {
+		t.Fatalf("bad: %v", err)
+	}
+	if j, err := Join(left, New[int]()); err != nil || j != left {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestJoin_SplitRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab/"
+		b := make([]byte, rnd.Intn(6))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 200; round++ {
+		r := New[int]()
+		for i := 0; i < rnd.Intn(30); i++ {
+			r, _, _ = r.Insert(randKey(), i)
+		}
+
+		left, right := r.Split(randKey())
+		j, err := Join(left, right)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if j.Len() != r.Len() {
+			t.Fatalf("bad: %d %d", j.Len(), r.Len())
+		}
+		checkCanonical(t, j.Root())
+		checkSizes(t, j.Root())
+		if !sameShape(j.Root(), r.Root()) {
+			t.Fatalf("joined tree differs from the original")
+		}
+		r.Root().Walk(func(k []byte, v int) bool {
+			if got, ok := j.Get(k); !ok || got != v {
+				t.Fatalf("bad: %q: %d %v", k, got, ok)
+			}
+			return false
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"context"
+	"time"
+)
+
+// Watcher waits for changes under a prefix across successive versions of a
+// tree, so that a reload loop doesn't need to re-subscribe to a new watch
+// channel by hand after every change. A tree doesn't know about the versions
+// that come after it, so the watcher is given a function that returns the
+// latest published version, such as the Load method of an atomic.Pointer that
+// writers store each new tree in.
+//
+// Changes are only seen by waiting on watch channels if the writers commit
+// with TrackMutate enabled. They should also publish each new tree before its
+// watches fire, by committing with CommitOnly, publishing the tree and then
+// calling Notify; a tree published after its watches fire is still seen, but
+// only once Wait next checks for it, as described there. A Watcher is not
+// thread safe, and should only be used by a single goroutine.
+type Watcher[T any] struct {
+	prefix  []byte
+	current func() *Tree[T]
+
+	// last is the last version handed back by Wait, or the tree the watcher
+	// was created from, which changes are detected against.
+	last *Tree[T]
+}
+
+// Watch returns a Watcher for changes under the given prefix, starting from
+// this tree, where current returns the latest published version of the tree.
+func (t *Tree[T]) Watch(prefix []byte, current func() *Tree[T]) *Watcher[T] {
+	return &Watcher[T]{
+		prefix:  prefix,
+		current: current,
+		last:    t,
+	}
+}
+
+// Wait blocks until the latest version of the tree differs under the prefix
+// from the version last returned, or from the tree the watcher was created
+// from, and then returns it. A change that was published before Wait is called
+// is returned straight away without waiting, so looping on Wait never misses
+// one, although several changes made in quick succession may be seen as one.
+// Versions that only change keys outside the prefix are skipped over, but like
+// SeekPrefixWatch, a write that restructures the node right at the prefix may
+// be reported even if no key under it changed. If ctx is done first then its
+// error is returned along with a nil tree.
+//
+// The watch channel for the latest version can fire for a commit that never
+// gets published, such as a transaction that was thrown away, or one of two
+// branched from the same tree, and then it stays closed. Until a new version
+// is published, Wait falls back to checking for one after a delay that backs
+// off from minWatchPoll to maxWatchPoll, rather than spinning.
+func (w *Watcher[T]) Wait(ctx context.Context) (*Tree[T], error) {
+	delay := time.Duration(0)
+	for {
+		latest := w.current()
+		if latest.root.prefixNode(w.prefix) != w.last.root.prefixNode(w.prefix) {
+			w.last = latest
+			return latest, nil
+		}
+		if latest != w.last {
+			delay = 0
+		}
+
+		// Nothing has changed under the prefix, so carry on from the latest
+		// version and wait on its channel for the prefix, unless that has
+		// already fired without a new version being published.
+		w.last = latest
+		watch := latest.root.Iterator().SeekPrefixWatch(w.prefix)
+		select {
+		case <-watch:
+			delay = min(max(2*delay, minWatchPoll), maxWatchPoll)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+			continue
+		default:
+		}
+
+		select {
+		case <-watch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+const (
+	// minWatchPoll and maxWatchPoll bound the delay between checks for a
+	// new version once the latest version's watch channel has fired
+	// without one being published.
+	minWatchPoll = time.Millisecond
+	maxWatchPoll = 100 * time.Millisecond
+)
@@ -0,0 +1,155 @@
+// Copyright IBM Corp. 2015, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// publisher holds the latest version of a tree, and commits changes to it the
+// way Watcher expects.
+type publisher struct {
+	latest atomic.Pointer[Tree[int]]
+}
+
+func (p *publisher) update(fn func(txn *Txn[int])) {
+	txn := p.latest.Load().Txn()
+	txn.TrackMutate(true)
+	fn(txn)
+	p.latest.Store(txn.CommitOnly())
+	txn.Notify()
+}
+
+func TestWatcher(t *testing.T) {
+	var p publisher
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("config/a"), 0)
+	r, _, _ = r.Insert([]byte("other"), 0)
+	p.latest.Store(r)
+	w := r.Watch([]byte("config/"), p.latest.Load)
+
+	// Nothing has changed yet.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if tree, err := w.Wait(ctx); err != context.DeadlineExceeded || tree != nil {
+		t.Fatalf("bad: %v %v", tree, err)
+	}
+
+	// A change outside the prefix is skipped over, and a change made before
+	// Wait is called is returned straight away.
+	p.update(func(txn *Txn[int]) { txn.Insert([]byte("other"), 1) })
+	p.update(func(txn *Txn[int]) { txn.Insert([]byte("config/b"), 2) })
+	tree, err := w.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v, ok := tree.Get([]byte("config/b")); !ok || v != 2 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+
+	// Having returned that version, there's nothing more to see.
+	p.update(func(txn *Txn[int]) { txn.Insert([]byte("other"), 2) })
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := w.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// A change that comes in while waiting wakes it up.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.update(func(txn *Txn[int]) { txn.Delete([]byte("config/a")) })
+	}()
+	tree, err = w.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := tree.Get([]byte("config/a")); ok {
+		t.Fatalf("bad")
+	}
+}
+
+func TestWatcher_RapidChanges(t *testing.T) {
+	var p publisher
+	p.latest.Store(New[int]())
+	w := p.latest.Load().Watch([]byte("config/"), p.latest.Load)
+
+	const n = 1000
+	go func() {
+		for i := 1; i <= n; i++ {
+			p.update(func(txn *Txn[int]) {
+				txn.Insert([]byte("config/version"), i)
+				txn.Insert([]byte("noise/"+strconv.Itoa(i)), i)
+			})
+		}
+	}()
+
+	// Every version returned is newer than the last, and the final one is
+	// always reached, however the changes were batched up.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	last := 0
+	for last < n {
+		tree, err := w.Wait(ctx)
+		if err != nil {
+			t.Fatalf("err: %v after version %d", err, last)
+		}
+		v, _ := tree.Get([]byte("config/version"))
+		if v <= last {
+			t.Fatalf("bad: version %d after %d", v, last)
+		}
+		last = v
+	}
+	if last != n {
+		t.Fatalf("bad: %d", last)
+	}
+}
+
+func TestWatcher_UnpublishedCommit(t *testing.T) {
+	r := New[int]()
+	r, _, _ = r.Insert([]byte("a.b"), 0)
+
+	// Count how often Wait checks for a new version.
+	var latest atomic.Pointer[Tree[int]]
+	latest.Store(r)
+	var checks atomic.Int32
+	current := func() *Tree[int] {
+		checks.Add(1)
+		return latest.Load()
+	}
+	w := r.Watch([]byte("a."), current)
+
+	// A tracked commit that's never published closes the channels Wait
+	// would otherwise block on.
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	txn.Insert([]byte("a.c"), 1)
+	txn.Commit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if tree, err := w.Wait(ctx); err != context.DeadlineExceeded || tree != nil {
+		t.Fatalf("bad: %v %v", tree, err)
+	}
+	if n := checks.Load(); n > 20 {
+		t.Fatalf("bad: checked %d times", n)
+	}
+
+	// A version published later is still picked up by checking for it.
+	// This one can't fire any watches, since the ones it would close for
+	// r are already closed.
+	published, _, _ := r.Insert([]byte("a.d"), 2)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		latest.Store(published)
+	}()
+	tree, err := w.Wait(context.Background())
+	if err != nil || tree != published {
+		t.Fatalf("bad: %v", err)
+	}
+}
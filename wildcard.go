@@ -1,6 +1,11 @@
 package iradix
 
-import "bytes"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // MatchWithWildcards checks if a key matches any pattern in the tree, considering wildcard
 // patterns at dot-separated segment boundaries. This performs a single tree traversal,
@@ -15,72 +20,767 @@ import "bytes"
 //   - "tenant.abc123.project.xyz789.member.*"
 //   - "tenant.abc123.project.xyz789.member.add" (exact match)
 //
-// The function returns true if any match is found.
+// A pattern "prefix.*" also matches "prefix" itself and "prefix.", whatever other keys
+// are in the tree. The function returns true if any match is found. Keys that were
+// inserted with InsertLiteral are never treated as patterns, so they only match an
+// identical key.
 func (n *Node[T]) MatchWithWildcards(key []byte) bool {
+	return n.MatchWithWildcardsSeps(key, dotSep)
+}
+
+// dotSep is the separator set used by MatchWithWildcards.
+var dotSep = []byte{'.'}
+
+// MatchWithWildcardsSeps is like MatchWithWildcards, but any of the given separator bytes
+// may mark a segment boundary instead of just '.'. For example, with seps ".:" the key
+// "svc.api:read" matches both "svc.*" and "svc.api:*". A trailing wildcard only matches
+// at the same separator it follows in the pattern, so "svc:*" doesn't match
+// "svc.api:read".
+func (n *Node[T]) MatchWithWildcardsSeps(key []byte, seps []byte) bool {
 	if len(key) == 0 {
 		_, ok := n.Get(key)
 		return ok
 	}
 
-	// Check for universal wildcard "*"
-	if _, ok := n.Get([]byte("*")); ok {
+	// Check for universal wildcard "*", using the flag if this is the root
+	// of a committed tree
+	switch n.wild {
+	case wildcardUniversal:
 		return true
+	case wildcardUnknown:
+		if isPattern(n.getLeaf([]byte("*"))) {
+			return true
+		}
 	}
 
 	// Perform tree traversal while checking for wildcards at dot boundaries
-	return n.matchWithWildcardsFrom(key, key)
+	return n.matchWithWildcardsFrom(key, key, seps)
+}
+
+// wildcardFlag says whether a tree holds the universal wildcard "*".
+type wildcardFlag uint8
+
+const (
+	// wildcardUnknown means the flag hasn't been worked out for this node,
+	// so the universal wildcard must be looked up.
+	wildcardUnknown wildcardFlag = iota
+
+	// wildcardNone means the tree doesn't hold the universal wildcard.
+	wildcardNone
+
+	// wildcardUniversal means the tree holds the universal wildcard as a
+	// pattern, so every non-empty key matches.
+	wildcardUniversal
+)
+
+// wildcardFlagFor works out the wildcard flag for the given root.
+func wildcardFlagFor[T any](root *Node[T]) wildcardFlag {
+	if isPattern(root.getLeaf([]byte("*"))) {
+		return wildcardUniversal
+	}
+	return wildcardNone
 }
 
-// matchWithWildcardsFrom performs the traversal.
+// matchWithWildcardsFrom performs the traversal. This walks down a single path
+// of the tree, so it's written as a loop rather than recursively to keep the
+// stack flat for keys with very many segments.
 // - originalKey: the full original key (never changes)
 // - search: the remaining part to search
-func (n *Node[T]) matchWithWildcardsFrom(originalKey, search []byte) bool {
-	// Base case: search exhausted - check for exact match
-	if len(search) == 0 {
-		return n.isLeaf()
+// - seps: the bytes that mark segment boundaries
+func (n *Node[T]) matchWithWildcardsFrom(originalKey, search, seps []byte) bool {
+	for {
+		// Before looking for the specific edge, check if there's a wildcard '*' edge
+		// This handles patterns like "tenant.*" where '*' is a direct child. The edge
+		// must hold exactly "*", otherwise it's a longer key like "tenant.*.x", and
+		// it must follow a separator, otherwise it's a key like "tenant*". The
+		// separator is the last byte consumed so far, since the universal wildcard
+		// at the root has already been checked.
+		consumed := len(originalKey) - len(search)
+		_, wildcardNode := n.getEdge('*')
+		if wildcardNode != nil && len(wildcardNode.prefix) == 1 && isPattern(wildcardNode.leaf) &&
+			consumed > 0 && bytes.IndexByte(seps, originalKey[consumed-1]) >= 0 {
+			// Found a wildcard pattern at this level
+			return true
+		}
+
+		// Base case: search exhausted - check for exact match, or a pattern
+		// like "tenant.*" for the key "tenant"
+		if len(search) == 0 {
+			return n.isLeaf() || trailingWildcard(n, nil, seps) != nil
+		}
+
+		// Look for the next edge matching our search
+		_, next := n.getEdge(search[0])
+		if next == nil {
+			return false
+		}
+
+		// Check if this node's prefix represents a wildcard pattern (ends with a
+		// separator and then "*", such as ".*")
+		if len(next.prefix) >= 2 &&
+			bytes.IndexByte(seps, next.prefix[len(next.prefix)-2]) >= 0 &&
+			next.prefix[len(next.prefix)-1] == '*' &&
+			isPattern(next.leaf) {
+			// This is a wildcard pattern. Check if search matches the prefix before ".*"
+			sep := next.prefix[len(next.prefix)-2]
+			wildcardPrefix := next.prefix[:len(next.prefix)-2] // Remove ".*"
+			if bytes.HasPrefix(search, wildcardPrefix) {
+				// The search key matches this wildcard pattern!
+				// Check if there's the same separator after the prefix (or it's the end)
+				if len(search) == len(wildcardPrefix) ||
+					(len(search) > len(wildcardPrefix) && search[len(wildcardPrefix)] == sep) {
+					return true
+				}
+			}
+		}
+
+		// Check if the node's prefix matches our search for normal traversal
+		if bytes.HasPrefix(search, next.prefix) {
+			// Prefix matches - consume it and carry on from the child
+			search = search[len(next.prefix):]
+			n = next
+			continue
+		} else if bytes.HasPrefix(next.prefix, search) {
+			// Search is shorter than prefix but matches what we have, so
+			// the rest of the prefix may complete a pattern for the key
+			return trailingWildcard(next, next.prefix[len(search):], seps) != nil
+		}
+
+		// Prefix mismatch
+		return false
+	}
+}
+
+// bestWildcardMatch returns the leaf for the most specific pattern that matches the key,
+// using the same rules as MatchWithWildcardsSeps, or nil if none match. An exact match is
+// the most specific, then the longest pattern ending in a separator and "*", and then
+// the universal wildcard, whose leaf is given by the caller so it can be looked up
+// ahead of time. This takes the same single path down the tree, but carries on past
+// the first match to find the deepest one.
+func (n *Node[T]) bestWildcardMatch(key, seps []byte, universal *leafNode[T]) *leafNode[T] {
+	if len(key) == 0 {
+		return n.leaf
+	}
+
+	best := universal
+	search := key
+	for {
+		// Each wildcard found on the way down is longer than the last.
+		consumed := len(key) - len(search)
+		_, wildcardNode := n.getEdge('*')
+		if wildcardNode != nil && len(wildcardNode.prefix) == 1 && isPattern(wildcardNode.leaf) &&
+			consumed > 0 && bytes.IndexByte(seps, key[consumed-1]) >= 0 {
+			best = wildcardNode.leaf
+		}
+
+		if len(search) == 0 {
+			if n.leaf != nil {
+				return n.leaf
+			}
+			if l := trailingWildcard(n, nil, seps); l != nil {
+				return l
+			}
+			return best
+		}
+
+		_, next := n.getEdge(search[0])
+		if next == nil {
+			return best
+		}
+
+		if len(next.prefix) >= 2 &&
+			bytes.IndexByte(seps, next.prefix[len(next.prefix)-2]) >= 0 &&
+			next.prefix[len(next.prefix)-1] == '*' &&
+			isPattern(next.leaf) {
+			sep := next.prefix[len(next.prefix)-2]
+			wildcardPrefix := next.prefix[:len(next.prefix)-2]
+			if len(search) > len(wildcardPrefix) && bytes.HasPrefix(search, wildcardPrefix) &&
+				search[len(wildcardPrefix)] == sep {
+				best = next.leaf
+			}
+		}
+
+		if bytes.HasPrefix(search, next.prefix) {
+			search = search[len(next.prefix):]
+			n = next
+			continue
+		} else if bytes.HasPrefix(next.prefix, search) {
+			if l := trailingWildcard(next, next.prefix[len(search):], seps); l != nil {
+				return l
+			}
+		}
+		return best
+	}
+}
+
+// MatchWithWildcardsBatchPatterns matches each of the given keys like
+// MatchWithWildcards, but returns the most specific pattern that each one
+// matched, in the same order as the keys, with nil for a key that didn't match
+// anything. The most specific pattern is the key itself, then the longest one
+// ending in ".*", and then the universal wildcard "*". The universal wildcard
+// is only looked up once for the whole batch, and a key that's the same as
+// the one before it reuses its result, so sorted input with repeated keys is
+// cheaper; otherwise each key takes a single path down the tree, which there
+// isn't much to share between. The returned patterns are the stored keys, so
+// they must not be modified.
+func (n *Node[T]) MatchWithWildcardsBatchPatterns(keys [][]byte) [][]byte {
+	var universal *leafNode[T]
+	if n.wild != wildcardNone {
+		if l := n.getLeaf([]byte("*")); isPattern(l) {
+			universal = l
+		}
+	}
+
+	out := make([][]byte, len(keys))
+	for i, key := range keys {
+		if i > 0 && bytes.Equal(key, keys[i-1]) {
+			out[i] = out[i-1]
+			continue
+		}
+		u := universal
+		if len(key) == 0 {
+			u = nil
+		}
+		if l := n.bestWildcardMatch(key, dotSep, u); l != nil {
+			out[i] = l.key
+		}
+	}
+	return out
+}
+
+// trailingWildcard returns the leaf for a pattern that is the key being matched
+// followed by a separator and "*", such as "tenant.*" for the key "tenant", or
+// nil if there isn't one. The key ends with the given rest of n's prefix still
+// to go, so n's leaf and edges are directly below the end of rest.
+func trailingWildcard[T any](n *Node[T], rest, seps []byte) *leafNode[T] {
+	// star returns the leaf of the pattern under a '*' edge that holds
+	// exactly "*", if there is one.
+	star := func(n *Node[T]) *leafNode[T] {
+		if _, s := n.getEdge('*'); s != nil && len(s.prefix) == 1 && isPattern(s.leaf) {
+			return s.leaf
+		}
+		return nil
+	}
+
+	switch len(rest) {
+	case 0:
+		for _, sep := range seps {
+			_, c := n.getEdge(sep)
+			switch {
+			case c == nil:
+			case len(c.prefix) == 2 && c.prefix[1] == '*' && isPattern(c.leaf):
+				return c.leaf
+			case len(c.prefix) == 1:
+				if l := star(c); l != nil {
+					return l
+				}
+			}
+		}
+	case 1:
+		if bytes.IndexByte(seps, rest[0]) >= 0 {
+			return star(n)
+		}
+	case 2:
+		if bytes.IndexByte(seps, rest[0]) >= 0 && rest[1] == '*' && isPattern(n.leaf) {
+			return n.leaf
+		}
+	}
+	return nil
+}
+
+// MatchSuffixWildcards checks if a key matches any pattern in the tree, considering
+// leading wildcard patterns of the form "*.suffix". The leading '*' stands for one or
+// more whole dot-separated segments, so "*.example.com" matches "api.example.com" and
+// "a.b.example.com", but never "example.com" itself since at least one segment must be
+// consumed by the wildcard. Exact matches and the universal wildcard "*" are honored
+// just like in MatchWithWildcards, and literal keys are never treated as patterns.
+//
+// Each candidate suffix is looked up directly, so this costs one lookup per segment in
+// the key rather than a scan of the stored patterns.
+func (n *Node[T]) MatchSuffixWildcards(key []byte) bool {
+	return n.matchSuffixWildcards(key, false)
+}
+
+// MatchSingleSuffixWildcard is like MatchSuffixWildcards, but the leading '*' stands for
+// exactly one segment. With this variant "*.example.com" matches "api.example.com" but
+// not "a.b.example.com".
+func (n *Node[T]) MatchSingleSuffixWildcard(key []byte) bool {
+	return n.matchSuffixWildcards(key, true)
+}
+
+// matchSuffixWildcards does the work for the leading wildcard matchers. If single is
+// set then only the first segment of the key may be consumed by the wildcard.
+func (n *Node[T]) matchSuffixWildcards(key []byte, single bool) bool {
+	// Check for an exact match first
+	if _, ok := n.Get(key); ok {
+		return true
+	}
+	if len(key) == 0 {
+		return false
 	}
 
-	// Before looking for the specific edge, check if there's a wildcard '*' edge
-	// This handles patterns like "tenant.*" where '*' is a direct child
-	_, wildcardNode := n.getEdge('*')
-	if wildcardNode != nil && wildcardNode.isLeaf() {
-		// Found a wildcard pattern at this level
+	// Check for universal wildcard "*"
+	if isPattern(n.getLeaf([]byte("*"))) {
 		return true
 	}
 
-	// Look for the next edge matching our search
-	_, next := n.getEdge(search[0])
-	if next == nil {
+	// All leading wildcard patterns live under the '*' edge, so there's
+	// nothing more to find if it's missing.
+	if _, star := n.getEdge('*'); star == nil {
 		return false
 	}
 
-	// Check if this node's prefix represents a wildcard pattern (ends with ".*")
-	if len(next.prefix) >= 2 &&
-	   next.prefix[len(next.prefix)-2] == '.' &&
-	   next.prefix[len(next.prefix)-1] == '*' &&
-	   next.isLeaf() {
-		// This is a wildcard pattern. Check if search matches the prefix before ".*"
-		wildcardPrefix := next.prefix[:len(next.prefix)-2] // Remove ".*"
-		if bytes.HasPrefix(search, wildcardPrefix) {
-			// The search key matches this wildcard pattern!
-			// Check if there's a dot after the prefix (or it's the end)
-			if len(search) == len(wildcardPrefix) ||
-			   (len(search) > len(wildcardPrefix) && search[len(wildcardPrefix)] == '.') {
-				return true
-			}
+	// Try "*" followed by the remainder of the key at each dot boundary,
+	// making sure the wildcard consumes a non-empty segment.
+	candidate := make([]byte, 1, len(key)+1)
+	candidate[0] = '*'
+	for i := 1; i < len(key); i++ {
+		if key[i] != '.' {
+			continue
+		}
+		candidate = append(candidate[:1], key[i:]...)
+		if isPattern(n.getLeaf(candidate)) {
+			return true
+		}
+		if single {
+			break
+		}
+	}
+	return false
+}
+
+// MatchWithRemainder is like MatchWithWildcards, but returns the most specific pattern
+// that matched along with its value and the remainder of the key that was consumed by
+// the pattern's trailing '*'. An exact match is preferred, with an empty remainder,
+// then the longest matching pattern ending in ".*", and finally the universal wildcard
+// "*", whose remainder is the whole key. For example, given "api.*" and "api.v1.*",
+// the key "api.v1.users.list" matches "api.v1.*" with the remainder "users.list".
+//
+// A pattern "prefix.*" matches "prefix" itself and any key that starts with "prefix.",
+// so the remainder may be empty. Like MatchWithWildcards, the empty key only matches
+// exactly. The remainder is a sub-slice of the key.
+func (n *Node[T]) MatchWithRemainder(key []byte) (pattern []byte, remainder []byte, value T, ok bool) {
+	// Check for an exact match first
+	if l := n.getLeaf(key); l != nil {
+		return l.key, key[len(key):], l.val, true
+	}
+
+	if len(key) == 0 {
+		var zero T
+		return nil, nil, zero, false
+	}
+
+	// Try the candidate patterns from the longest down, so the first one
+	// found is the most specific, starting with the key itself followed by
+	// ".*" which matches with an empty remainder.
+	candidate := make([]byte, 0, len(key)+2)
+	candidate = append(append(candidate, key...), '.', '*')
+	if l := n.getLeaf(candidate); isPattern(l) {
+		return l.key, key[len(key):], l.val, true
+	}
+	for i := len(key) - 1; i >= 0; i-- {
+		if key[i] != '.' {
+			continue
+		}
+		candidate = append(append(candidate[:0], key[:i+1]...), '*')
+		if l := n.getLeaf(candidate); isPattern(l) {
+			return l.key, key[i+1:], l.val, true
+		}
+	}
+
+	// Check for universal wildcard "*"
+	if l := n.getLeaf([]byte("*")); isPattern(l) {
+		return l.key, key, l.val, true
+	}
+
+	var zero T
+	return nil, nil, zero, false
+}
+
+// MatchWithWildcardsMaxDepth is like MatchWithWildcards, but a wildcard pattern
+// may only match if it's within maxWildcardDepth segments of the root. The
+// depth of a pattern ending in ".*" is the number of segments before the
+// wildcard, so "tenant.*" has depth 1 and "tenant.abc.project.*" has depth 3,
+// while the universal wildcard "*" has depth 0. Exact matches are always
+// allowed, and a negative maxWildcardDepth allows no wildcards at all. For
+// example, with a depth of 1 the key "tenant.abc.project" matches "tenant.*"
+// but not "tenant.abc.*".
+//
+// Each allowed candidate pattern is looked up directly, so this costs one
+// lookup per segment up to the maximum depth.
+func (n *Node[T]) MatchWithWildcardsMaxDepth(key []byte, maxWildcardDepth int) bool {
+	// Check for an exact match first
+	if _, ok := n.Get(key); ok {
+		return true
+	}
+	if len(key) == 0 || maxWildcardDepth < 0 {
+		return false
+	}
+
+	// Check for universal wildcard "*"
+	if isPattern(n.getLeaf([]byte("*"))) {
+		return true
+	}
+
+	// Try the prefix before each dot followed by ".*", with one more
+	// segment each time, and finally the whole key followed by ".*".
+	candidate := make([]byte, 0, len(key)+2)
+	depth := 0
+	for i := 0; i <= len(key) && depth < maxWildcardDepth; i++ {
+		if i < len(key) && key[i] != '.' {
+			continue
+		}
+		depth++
+		candidate = append(append(candidate[:0], key[:i]...), '.', '*')
+		if isPattern(n.getLeaf(candidate)) {
+			return true
 		}
 	}
+	return false
+}
+
+// MatchNATS is like MatchWithWildcards, but also accepts the NATS-style full
+// wildcard: a pattern "prefix.>" matches "prefix" itself and every key below it
+// at a segment boundary, so "tenant.abc.>" matches "tenant.abc", "tenant.abc.x"
+// and "tenant.abc.x.y", but not "tenant.abcd". A lone ">" matches any
+// non-empty key, like "*". A pattern ending in ".*" already matches everything
+// below its prefix here rather than a single segment, so the two forms match
+// the same keys and neither takes precedence; ".>" just allows rules written
+// for NATS to be stored as they are. Literal keys are never patterns.
+//
+// The ".*" patterns are matched by MatchWithWildcards, and then each candidate
+// ".>" pattern is looked up directly, so this costs one more lookup per
+// segment in the key.
+func (n *Node[T]) MatchNATS(key []byte) bool {
+	if n.MatchWithWildcards(key) {
+		return true
+	}
+	if len(key) == 0 {
+		return false
+	}
 
-	// Check if the node's prefix matches our search for normal traversal
-	if bytes.HasPrefix(search, next.prefix) {
-		// Prefix matches - consume it and recurse
-		return next.matchWithWildcardsFrom(originalKey, search[len(next.prefix):])
-	} else if bytes.HasPrefix(next.prefix, search) {
-		// Search is shorter than prefix but matches what we have
-		// Check if this is an exact match (we've consumed all of search)
-		return next.isLeaf() && len(search) == len(next.prefix)
+	// Check for the full wildcard ">"
+	if isPattern(n.getLeaf([]byte(">"))) {
+		return true
 	}
 
-	// Prefix mismatch
+	// Try the prefix before each dot followed by ".>", and then the whole key.
+	candidate := make([]byte, 0, len(key)+2)
+	for i := 0; i <= len(key); i++ {
+		if i < len(key) && key[i] != '.' {
+			continue
+		}
+		candidate = append(append(candidate[:0], key[:i]...), '.', '>')
+		if isPattern(n.getLeaf(candidate)) {
+			return true
+		}
+	}
 	return false
 }
+
+// WildcardStats counts the keys in the tree by how MatchWithWildcards treats
+// them. universal is set if the tree holds the universal wildcard "*",
+// wildcards is the number of keys ending in ".*", and exact is the number of
+// all the other keys apart from "*" itself, so wildcards and exact add up to
+// the size of the tree, less one if universal is set. Keys that were inserted
+// with InsertLiteral are always counted as exact, even if they look like
+// wildcards, since they're never matched as patterns; any other key ending in
+// ".*" is counted as a wildcard, whatever it was meant to be. This visits
+// every leaf in the tree.
+func (n *Node[T]) WildcardStats() (universal bool, wildcards int, exact int) {
+	walkLeaves(n, func(leaf *leafNode[T]) {
+		switch {
+		case !isPattern(leaf):
+			exact++
+		case bytes.Equal(leaf.key, []byte("*")):
+			universal = true
+		case bytes.HasSuffix(leaf.key, []byte(".*")):
+			wildcards++
+		default:
+			exact++
+		}
+	})
+	return universal, wildcards, exact
+}
+
+// WildcardPatterns returns every key in the tree that MatchWithWildcards treats
+// as a pattern, which is the universal wildcard "*" and any key ending in ".*",
+// in key order. Keys that were inserted with InsertLiteral are left out, even
+// if they look like patterns. This visits every leaf in the tree, and the
+// returned keys are the stored keys, so they must not be modified.
+func (n *Node[T]) WildcardPatterns() [][]byte {
+	var out [][]byte
+	walkLeaves(n, func(leaf *leafNode[T]) {
+		if isPattern(leaf) && isWildcardPattern(leaf.key) {
+			out = append(out, leaf.key)
+		}
+	})
+	return out
+}
+
+// KeysMatchingWildcard returns the keys in the tree that the given pattern
+// would match under the rules of MatchWithWildcards, in key order. This is the
+// reverse of the matchers, for a tree that holds data keys rather than
+// patterns: "tenant.*" returns "tenant" and every key that starts with
+// "tenant.", however many segments follow; "*" returns every non-empty key,
+// and any other pattern returns just itself if it's present. Keys that are
+// themselves patterns are left out, but keys inserted with InsertLiteral are
+// data, so they're included. Only the subtree under the part of the pattern
+// before the wildcard is visited, and the returned keys are the stored keys,
+// so they must not be modified.
+func (n *Node[T]) KeysMatchingWildcard(pattern []byte) [][]byte {
+	var out [][]byte
+	data := func(l *leafNode[T]) {
+		if !isPattern(l) || !isWildcardPattern(l.key) {
+			out = append(out, l.key)
+		}
+	}
+
+	switch {
+	case bytes.Equal(pattern, []byte("*")):
+		walkLeaves(n, func(l *leafNode[T]) {
+			if len(l.key) > 0 {
+				data(l)
+			}
+		})
+	case bytes.HasSuffix(pattern, []byte(".*")):
+		// Like the matchers, ".*" doesn't match the empty key.
+		if base := pattern[:len(pattern)-2]; len(base) > 0 {
+			if l := n.getLeaf(base); l != nil {
+				data(l)
+			}
+		}
+		if pn := n.prefixNode(pattern[:len(pattern)-1]); pn != nil {
+			walkLeaves(pn, data)
+		}
+	default:
+		if l := n.getLeaf(pattern); l != nil {
+			data(l)
+		}
+	}
+	return out
+}
+
+// isPattern returns true if the given leaf exists and may be interpreted as a
+// wildcard pattern, i.e. it wasn't inserted as a literal.
+func isPattern[T any](l *leafNode[T]) bool {
+	return l != nil && !l.literal
+}
+
+var (
+	// ErrWildcardMidSegment is returned by ValidateWildcardPattern for a '*'
+	// that shares a segment with other bytes, such as "ten*ant" or "a.b*".
+	ErrWildcardMidSegment = errors.New("wildcard must be a whole segment")
+
+	// ErrWildcardNotLast is returned by ValidateWildcardPattern for a '*'
+	// segment with more segments after it, such as "a.*.b".
+	ErrWildcardNotLast = errors.New("wildcard must be the last segment")
+
+	// ErrMultiLevelWildcard is returned by ValidateWildcardPattern for "**",
+	// which isn't supported.
+	ErrMultiLevelWildcard = errors.New("multi-level wildcard is not supported")
+
+	// ErrWildcardNoPrefix is returned by ValidateWildcardPattern for ".*",
+	// which has an empty segment in front of the wildcard.
+	ErrWildcardNoPrefix = errors.New("wildcard needs a prefix before the separator")
+
+	// ErrSegmentSeparator is returned by WildcardPattern for a segment that
+	// holds a '.', such as "a.b", which would make more than one segment.
+	ErrSegmentSeparator = errors.New("segment must not contain a separator")
+)
+
+// ValidateWildcardPattern checks that a key is well formed for the wildcard
+// matching done by MatchWithWildcards. A legal key is one of:
+//   - "*", the universal wildcard
+//   - a prefix followed by ".*", where the prefix is non-empty and contains
+//     no '*', such as "tenant.*" or "tenant.abc.*"
+//   - any key containing no '*' at all, which is only matched exactly
+//
+// Anything else returns an error wrapping one of ErrMultiLevelWildcard,
+// ErrWildcardMidSegment, ErrWildcardNotLast or ErrWildcardNoPrefix, for the
+// first '*' in the key that's at fault, so it can be rejected before it's
+// inserted. Leading wildcards such as "*.example.com", as used by
+// MatchSuffixWildcards, aren't legal here. Keys that are meant as data rather
+// than patterns don't need to be valid, and can be inserted with
+// InsertLiteral instead.
+func ValidateWildcardPattern(pattern []byte) error {
+	i := bytes.IndexByte(pattern, '*')
+	if i < 0 {
+		return nil
+	}
+	fail := func(err error) error {
+		return fmt.Errorf("%w: %q at offset %d", err, pattern, i)
+	}
+
+	switch {
+	case i+1 < len(pattern) && pattern[i+1] == '*':
+		return fail(ErrMultiLevelWildcard)
+	case i > 0 && pattern[i-1] != '.':
+		return fail(ErrWildcardMidSegment)
+	case i+1 < len(pattern) && pattern[i+1] != '.':
+		return fail(ErrWildcardMidSegment)
+	case i+1 < len(pattern):
+		return fail(ErrWildcardNotLast)
+	case i == 1:
+		return fail(ErrWildcardNoPrefix)
+	}
+	return nil
+}
+
+// WildcardPattern builds a pattern from literal segments, joining them with
+// '.' and putting the wildcard segment "*" at the index wildcardAt, so
+// ([]string{"tenant", "abc"}, 2) gives "tenant.abc.*" and (nil, 0) gives the
+// universal wildcard "*". Since the wildcard must be the last segment,
+// wildcardAt must be len(segments), or negative to build an exact key with no
+// wildcard at all; any other index returns an error wrapping
+// ErrWildcardNotLast. A segment holding a '*' returns an error wrapping
+// ErrWildcardMidSegment, or ErrWildcardNotLast if it's a whole "*", and one
+// holding a '.', which would split it into more segments than were given,
+// returns an error wrapping ErrSegmentSeparator. The result must also pass
+// ValidateWildcardPattern, so for example ([]string{""}, 1) returns its error.
+func WildcardPattern(segments []string, wildcardAt int) ([]byte, error) {
+	if wildcardAt >= 0 && wildcardAt != len(segments) {
+		return nil, fmt.Errorf("%w: index %d of %d segments", ErrWildcardNotLast, wildcardAt, len(segments))
+	}
+	var out []byte
+	for i, s := range segments {
+		switch {
+		case s == "*":
+			return nil, fmt.Errorf("%w: segment %q at index %d", ErrWildcardNotLast, s, i)
+		case strings.IndexByte(s, '*') >= 0:
+			return nil, fmt.Errorf("%w: segment %q at index %d", ErrWildcardMidSegment, s, i)
+		case strings.IndexByte(s, '.') >= 0:
+			return nil, fmt.Errorf("%w: segment %q at index %d", ErrSegmentSeparator, s, i)
+		}
+		if i > 0 {
+			out = append(out, '.')
+		}
+		out = append(out, s...)
+	}
+	if wildcardAt >= 0 {
+		if len(segments) > 0 {
+			out = append(out, '.')
+		}
+		out = append(out, '*')
+	}
+	if err := ValidateWildcardPattern(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParseWildcardPattern is the inverse of WildcardPattern, splitting a pattern
+// into its literal segments and the index of the wildcard segment, which is -1
+// for an exact key. The universal wildcard "*" has no segments and an index of
+// 0. A pattern that fails ValidateWildcardPattern returns its error.
+func ParseWildcardPattern(pattern []byte) (segments []string, wildcardIndex int, err error) {
+	if err := ValidateWildcardPattern(pattern); err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case bytes.Equal(pattern, []byte("*")):
+		return nil, 0, nil
+	case bytes.HasSuffix(pattern, []byte(".*")):
+		segments = strings.Split(string(pattern[:len(pattern)-2]), ".")
+		return segments, len(segments), nil
+	default:
+		return strings.Split(string(pattern), "."), -1, nil
+	}
+}
+
+// WildcardMatcher matches a key against the patterns in a tree one byte at a
+// time, as the key arrives, using the same rules as MatchWithWildcards. It
+// walks down the tree as each byte is given to Advance, so it can tell as
+// soon as no pattern could match the key, however it carries on, without
+// waiting for the rest of it. Once the key has reached the separator of a
+// pattern like "tenant.*", or the tree holds the universal wildcard "*", the
+// key matches however it continues. A WildcardMatcher is not thread safe.
+type WildcardMatcher[T any] struct {
+	// cur is the deepest node reached, and rest is the part of its prefix
+	// that the key hasn't reached yet, so the key ends at cur's leaf and
+	// edges once rest is empty. cur is nil once the key has left the tree.
+	cur  *Node[T]
+	rest []byte
+
+	// n is the number of bytes given so far.
+	n int
+
+	// best is the leaf of the longest pattern ending in ".*" whose separator
+	// the key has passed, and universal is the leaf of the universal
+	// wildcard, if the tree has them.
+	best      *leafNode[T]
+	universal *leafNode[T]
+}
+
+// NewWildcardMatcher returns a WildcardMatcher for matching a key against the
+// patterns under this node, starting with an empty key.
+func (n *Node[T]) NewWildcardMatcher() *WildcardMatcher[T] {
+	m := &WildcardMatcher[T]{cur: n}
+	if n.wild != wildcardNone {
+		if l := n.getLeaf([]byte("*")); isPattern(l) {
+			m.universal = l
+		}
+	}
+	return m
+}
+
+// Advance adds the next byte to the key, returning false if the key can no
+// longer match any pattern, whatever bytes follow. Once it returns false it
+// always will.
+func (m *WildcardMatcher[T]) Advance(b byte) (stillPossible bool) {
+	m.n++
+	if m.cur != nil {
+		if len(m.rest) > 0 {
+			if m.rest[0] == b {
+				m.rest = m.rest[1:]
+			} else {
+				m.cur = nil
+			}
+		} else if _, next := m.cur.getEdge(b); next != nil {
+			m.cur, m.rest = next, next.prefix[1:]
+		} else {
+			m.cur = nil
+		}
+	}
+
+	// Having just passed a separator, a "*" straight after it makes a
+	// pattern that matches every key from here on.
+	if m.cur != nil && b == '.' {
+		switch {
+		case len(m.rest) == 0:
+			if _, s := m.cur.getEdge('*'); s != nil && len(s.prefix) == 1 && isPattern(s.leaf) {
+				m.best = s.leaf
+			}
+		case len(m.rest) == 1 && m.rest[0] == '*' && isPattern(m.cur.leaf):
+			m.best = m.cur.leaf
+		}
+	}
+	return m.cur != nil || m.best != nil || m.universal != nil
+}
+
+// Matched returns the most specific pattern that the key given so far
+// matches, using the same order as MatchWithRemainder: the key itself, then
+// the key followed by ".*", then the longest pattern ending in ".*" whose
+// separator the key has passed, and then the universal wildcard. Like
+// MatchWithWildcards, the empty key only matches exactly. The returned
+// pattern is the stored key, so it must not be modified.
+func (m *WildcardMatcher[T]) Matched() (pattern []byte, ok bool) {
+	if m.cur != nil {
+		if len(m.rest) == 0 && m.cur.leaf != nil {
+			return m.cur.leaf.key, true
+		}
+		if m.n == 0 {
+			return nil, false
+		}
+		if l := trailingWildcard(m.cur, m.rest, dotSep); l != nil {
+			return l.key, true
+		}
+	}
+	if m.best != nil {
+		return m.best.key, true
+	}
+	if m.universal != nil && m.n > 0 {
+		return m.universal.key, true
+	}
+	return nil, false
+}
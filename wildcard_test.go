@@ -0,0 +1,1143 @@
+package iradix
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMatchSuffixWildcards(t *testing.T) {
+	r := New[bool]()
+	patterns := []string{
+		"*.example.com",
+		"*.internal",
+		"exact.example.org",
+	}
+	for _, p := range patterns {
+		r, _, _ = r.Insert([]byte(p), true)
+	}
+
+	type exp struct {
+		inp    string
+		multi  bool
+		single bool
+	}
+	cases := []exp{
+		{"api.example.com", true, true},
+		{"a.b.example.com", true, false},
+		{"x.y.z.example.com", true, false},
+		{"example.com", false, false},
+		{".example.com", false, false},
+		{"apiexample.com", false, false},
+		{"api.example.co", false, false},
+		{"api.example.com.evil", false, false},
+		{"db.internal", true, true},
+		{"a.db.internal", true, false},
+		{"internal", false, false},
+		{"exact.example.org", true, true},
+		{"sub.exact.example.org", false, false},
+		{"*.example.com", true, true},
+		{"", false, false},
+	}
+
+	root := r.Root()
+	for _, test := range cases {
+		if got := root.MatchSuffixWildcards([]byte(test.inp)); got != test.multi {
+			t.Fatalf("multi mis-match: %q got %v want %v", test.inp, got, test.multi)
+		}
+		if got := root.MatchSingleSuffixWildcard([]byte(test.inp)); got != test.single {
+			t.Fatalf("single mis-match: %q got %v want %v", test.inp, got, test.single)
+		}
+	}
+
+	// The universal wildcard matches everything.
+	r, _, _ = r.Insert([]byte("*"), true)
+	root = r.Root()
+	for _, k := range []string{"example.com", "anything", "a.b.c"} {
+		if !root.MatchSuffixWildcards([]byte(k)) || !root.MatchSingleSuffixWildcard([]byte(k)) {
+			t.Fatalf("universal wildcard didn't match %q", k)
+		}
+	}
+}
+
+func TestMatchWithWildcards_Literal(t *testing.T) {
+	r := New[bool]()
+	r, _, _ = r.InsertLiteral([]byte("a.*.b"), true)
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), true)
+	r, _, _ = r.Insert([]byte("pat.*"), true)
+	r, _, _ = r.Insert([]byte("a.x"), true)
+
+	type exp struct {
+		inp string
+		out bool
+	}
+	cases := []exp{
+		{"a.*.b", true},
+		{"a.y", false},
+		{"a.y.b", false},
+		{"a.*", false},
+		{"a.x", true},
+		{"lit.*", true},
+		{"lit.x", false},
+		{"lit", false},
+		{"pat.x", true},
+		{"pat.x.y", true},
+	}
+	root := r.Root()
+	for _, test := range cases {
+		if got := root.MatchWithWildcards([]byte(test.inp)); got != test.out {
+			t.Fatalf("mis-match: %q got %v want %v", test.inp, got, test.out)
+		}
+	}
+
+	// A literal universal wildcard is just data.
+	r, _, _ = r.InsertLiteral([]byte("*"), true)
+	root = r.Root()
+	if root.MatchWithWildcards([]byte("anything")) {
+		t.Fatalf("literal * matched as a wildcard")
+	}
+	if !root.MatchWithWildcards([]byte("*")) {
+		t.Fatalf("literal * didn't match itself")
+	}
+	if root.MatchSuffixWildcards([]byte("anything")) {
+		t.Fatalf("literal * matched as a suffix wildcard")
+	}
+
+	// Re-inserting a literal key normally makes it a pattern again.
+	r, _, _ = r.Insert([]byte("lit.*"), true)
+	if !r.Root().MatchWithWildcards([]byte("lit.x")) {
+		t.Fatalf("re-inserted pattern didn't match")
+	}
+	r, _, _ = r.InsertLiteral([]byte("*.example.com"), true)
+	if r.Root().MatchSuffixWildcards([]byte("api.example.com")) {
+		t.Fatalf("literal leading wildcard matched")
+	}
+}
+
+func TestMatchWithWildcardsSeps(t *testing.T) {
+	r := New[bool]()
+	for _, p := range []string{"svc.*", "svc.api:*", "db:*", "db:x", "exact.key:name", "ab*", "abx"} {
+		r, _, _ = r.Insert([]byte(p), true)
+	}
+
+	type exp struct {
+		inp  string
+		seps bool
+		dots bool
+	}
+	cases := []exp{
+		{"svc.api:read", true, true},
+		{"svc.web", true, true},
+		{"svc.api:write:all", true, true},
+		{"svc:api", false, false},
+		{"svcx.api", false, false},
+		{"db:users", true, false},
+		{"db:users.rows", true, false},
+		{"db.users", false, false},
+		{"dbx:users", false, false},
+		{"exact.key:name", true, true},
+		{"exact.key:other", false, false},
+		{"other", false, false},
+		{"abc", false, false},
+		{"ab*", true, true},
+	}
+	root := r.Root()
+	for _, test := range cases {
+		if got := root.MatchWithWildcardsSeps([]byte(test.inp), []byte(".:")); got != test.seps {
+			t.Fatalf("seps mis-match: %q got %v want %v", test.inp, got, test.seps)
+		}
+		if got := root.MatchWithWildcardsSeps([]byte(test.inp), []byte(".")); got != test.dots {
+			t.Fatalf("dots mis-match: %q got %v want %v", test.inp, got, test.dots)
+		}
+		if got := root.MatchWithWildcards([]byte(test.inp)); got != test.dots {
+			t.Fatalf("default mis-match: %q got %v want %v", test.inp, got, test.dots)
+		}
+	}
+}
+
+// matchWithWildcardsRecursive is the original recursive form of the wildcard
+// matcher, kept as a reference for the iterative one.
+func matchWithWildcardsRecursive[T any](n *Node[T], originalKey, search, seps []byte) bool {
+	if len(search) == 0 {
+		return n.isLeaf()
+	}
+
+	consumed := len(originalKey) - len(search)
+	_, wildcardNode := n.getEdge('*')
+	if wildcardNode != nil && len(wildcardNode.prefix) == 1 && isPattern(wildcardNode.leaf) &&
+		consumed > 0 && bytes.IndexByte(seps, originalKey[consumed-1]) >= 0 {
+		return true
+	}
+
+	_, next := n.getEdge(search[0])
+	if next == nil {
+		return false
+	}
+
+	if len(next.prefix) >= 2 &&
+		bytes.IndexByte(seps, next.prefix[len(next.prefix)-2]) >= 0 &&
+		next.prefix[len(next.prefix)-1] == '*' &&
+		isPattern(next.leaf) {
+		sep := next.prefix[len(next.prefix)-2]
+		wildcardPrefix := next.prefix[:len(next.prefix)-2]
+		if bytes.HasPrefix(search, wildcardPrefix) {
+			if len(search) == len(wildcardPrefix) ||
+				(len(search) > len(wildcardPrefix) && search[len(wildcardPrefix)] == sep) {
+				return true
+			}
+		}
+	}
+
+	if bytes.HasPrefix(search, next.prefix) {
+		return matchWithWildcardsRecursive(next, originalKey, search[len(next.prefix):], seps)
+	} else if bytes.HasPrefix(next.prefix, search) {
+		return next.isLeaf() && len(search) == len(next.prefix)
+	}
+	return false
+}
+
+// matchWithWildcardsTrailing is matchWithWildcardsRecursive with the rule that
+// a trailing wildcard such as "tenant.*" also matches "tenant" and "tenant.",
+// whatever the shape of the tree. It's the reference for the iterative matcher.
+func matchWithWildcardsTrailing[T any](n *Node[T], originalKey, search, seps []byte) bool {
+	consumed := len(originalKey) - len(search)
+	_, wildcardNode := n.getEdge('*')
+	if wildcardNode != nil && len(wildcardNode.prefix) == 1 && isPattern(wildcardNode.leaf) &&
+		consumed > 0 && bytes.IndexByte(seps, originalKey[consumed-1]) >= 0 {
+		return true
+	}
+
+	if len(search) == 0 {
+		return n.isLeaf() || trailingWildcard(n, nil, seps) != nil
+	}
+
+	_, next := n.getEdge(search[0])
+	if next == nil {
+		return false
+	}
+
+	if len(next.prefix) >= 2 &&
+		bytes.IndexByte(seps, next.prefix[len(next.prefix)-2]) >= 0 &&
+		next.prefix[len(next.prefix)-1] == '*' &&
+		isPattern(next.leaf) {
+		sep := next.prefix[len(next.prefix)-2]
+		wildcardPrefix := next.prefix[:len(next.prefix)-2]
+		if bytes.HasPrefix(search, wildcardPrefix) {
+			if len(search) == len(wildcardPrefix) ||
+				(len(search) > len(wildcardPrefix) && search[len(wildcardPrefix)] == sep) {
+				return true
+			}
+		}
+	}
+
+	if bytes.HasPrefix(search, next.prefix) {
+		return matchWithWildcardsTrailing(next, originalKey, search[len(next.prefix):], seps)
+	} else if bytes.HasPrefix(next.prefix, search) {
+		return trailingWildcard(next, next.prefix[len(search):], seps) != nil
+	}
+	return false
+}
+
+func TestMatchWithWildcards_Iterative(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func(letters string) []byte {
+		b := make([]byte, rnd.Intn(8))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+	reference := func(n *Node[bool], key, seps []byte) bool {
+		if len(key) == 0 {
+			_, ok := n.Get(key)
+			return ok
+		}
+		if isPattern(n.getLeaf([]byte("*"))) {
+			return true
+		}
+		return matchWithWildcardsTrailing(n, key, key, seps)
+	}
+
+	// The original matcher only differs where a trailing wildcard now
+	// matches its own prefix, which it used to for some tree shapes only.
+	original := func(n *Node[bool], key, seps []byte) bool {
+		if len(key) == 0 {
+			_, ok := n.Get(key)
+			return ok
+		}
+		if isPattern(n.getLeaf([]byte("*"))) {
+			return true
+		}
+		return matchWithWildcardsRecursive(n, key, key, seps)
+	}
+	trailing := func(n *Node[bool], key, seps []byte) bool {
+		if len(key) > 0 && bytes.IndexByte(seps, key[len(key)-1]) >= 0 &&
+			isPattern(n.getLeaf(append(append([]byte{}, key...), '*'))) {
+			return true
+		}
+		for _, sep := range seps {
+			if isPattern(n.getLeaf(append(append([]byte{}, key...), sep, '*'))) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for round := 0; round < 500; round++ {
+		r := New[bool]()
+		for i := 0; i < 15; i++ {
+			p := randKey("ab.:*")
+			if rnd.Intn(5) == 0 {
+				r, _, _ = r.InsertLiteral(p, true)
+			} else {
+				r, _, _ = r.Insert(p, true)
+			}
+		}
+		root := r.Root()
+		for i := 0; i < 50; i++ {
+			key := randKey("ab.:*")
+			for _, seps := range [][]byte{[]byte("."), []byte(".:")} {
+				if got, want := root.MatchWithWildcardsSeps(key, seps), reference(root, key, seps); got != want {
+					t.Fatalf("mis-match: %q seps %q got %v want %v", key, seps, got, want)
+				}
+				if got, was := reference(root, key, seps), original(root, key, seps); got != was && (was || !trailing(root, key, seps)) {
+					t.Fatalf("changed: %q seps %q got %v was %v", key, seps, got, was)
+				}
+			}
+		}
+	}
+}
+
+func benchmarkLongKey(segments int) (*Node[bool], []byte) {
+	var sb strings.Builder
+	for i := 0; i < segments; i++ {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(strconv.Itoa(i))
+	}
+	key := []byte(sb.String())
+
+	// Store the key itself plus a pattern at every segment so the match
+	// has to walk all the way down to find the exact match, passing a
+	// '*' sibling at each level that isn't a pattern.
+	r := New[bool]()
+	r, _, _ = r.Insert(key, true)
+	for i := 0; i < len(key); i++ {
+		if key[i] == '.' {
+			r, _, _ = r.Insert(append([]byte(string(key[:i+1])), "*x"...), true)
+		}
+	}
+	return r.Root(), key
+}
+
+func BenchmarkMatchWithWildcards_LongKey(b *testing.B) {
+	root, key := benchmarkLongKey(2000)
+	b.Run("Iterative", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if !root.MatchWithWildcards(key) {
+				b.Fatalf("expected a match")
+			}
+		}
+	})
+	b.Run("Recursive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if !matchWithWildcardsTrailing(root, key, key, dotSep) {
+				b.Fatalf("expected a match")
+			}
+		}
+	})
+}
+
+func TestMatchWithRemainder(t *testing.T) {
+	r := New[int]()
+	for i, p := range []string{"api.*", "api.v1.*", "api.v1.users.list", "static.files.*"} {
+		r, _, _ = r.Insert([]byte(p), i)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), 9)
+
+	type exp struct {
+		inp       string
+		pattern   string
+		remainder string
+		value     int
+		ok        bool
+	}
+	cases := []exp{
+		{"api.v1.users.list", "api.v1.users.list", "", 2, true},
+		{"api.v1.users.get", "api.v1.*", "users.get", 1, true},
+		{"api.v1.x", "api.v1.*", "x", 1, true},
+		{"api.v2.users", "api.*", "v2.users", 0, true},
+		{"api.v1.", "api.v1.*", "", 1, true},
+		{"api", "api.*", "", 0, true},
+		{"api.v1", "api.v1.*", "", 1, true},
+		{"apix.v1", "", "", 0, false},
+		{"static.files.css.main.css", "static.files.*", "css.main.css", 3, true},
+		{"static.other", "", "", 0, false},
+		{"lit.x", "", "", 0, false},
+		{"lit.*", "lit.*", "", 9, true},
+		{"", "", "", 0, false},
+	}
+	check := func(root *Node[int], cases []exp) {
+		t.Helper()
+		for _, test := range cases {
+			pattern, remainder, value, ok := root.MatchWithRemainder([]byte(test.inp))
+			if ok != test.ok || string(pattern) != test.pattern || string(remainder) != test.remainder || value != test.value {
+				t.Fatalf("mis-match: %q got %q %q %d %v", test.inp, pattern, remainder, value, ok)
+			}
+			if ok && remainder == nil {
+				t.Fatalf("expected a non-nil remainder for %q", test.inp)
+			}
+		}
+	}
+	check(r.Root(), cases)
+
+	// The universal wildcard is the last resort and consumes the whole key.
+	r, _, _ = r.Insert([]byte("*"), 10)
+	check(r.Root(), []exp{
+		{"api.v1.x", "api.v1.*", "x", 1, true},
+		{"static.other", "*", "static.other", 10, true},
+		{"lit.x", "*", "lit.x", 10, true},
+		{"", "", "", 0, false},
+	})
+}
+
+func TestMatchWithWildcards_TrailingWildcard(t *testing.T) {
+	// A "prefix.*" pattern also matches "prefix" itself, whichever other
+	// keys share its nodes.
+	others := [][]string{
+		nil,
+		{"a.b"},
+		{"a."},
+		{"a.*.x"},
+		{"a.*x"},
+		{"a"},
+		{"ab"},
+	}
+	for _, extra := range others {
+		r := New[bool]()
+		r, _, _ = r.Insert([]byte("a.*"), true)
+		for _, k := range extra {
+			r, _, _ = r.Insert([]byte(k), true)
+		}
+		root := r.Root()
+		for _, k := range []string{"a", "a.", "a.b", "a.b.c"} {
+			if !root.MatchWithWildcards([]byte(k)) {
+				t.Fatalf("expected %q to match with %v", k, extra)
+			}
+		}
+		for _, k := range []string{"ab", "b", "a*"} {
+			if root.MatchWithWildcards([]byte(k)) != (len(extra) == 1 && extra[0] == k) {
+				t.Fatalf("bad match for %q with %v", k, extra)
+			}
+		}
+	}
+
+	// Other separators work the same way.
+	r := New[bool]()
+	r, _, _ = r.Insert([]byte("svc:*"), true)
+	r, _, _ = r.Insert([]byte("svc:x"), true)
+	if !r.Root().MatchWithWildcardsSeps([]byte("svc"), []byte(".:")) {
+		t.Fatalf("expected a match")
+	}
+	if r.Root().MatchWithWildcards([]byte("svc")) {
+		t.Fatalf("unexpected match")
+	}
+
+	// Literal keys are still just data.
+	r = New[bool]()
+	r, _, _ = r.InsertLiteral([]byte("a.*"), true)
+	r, _, _ = r.Insert([]byte("a.b"), true)
+	if r.Root().MatchWithWildcards([]byte("a")) {
+		t.Fatalf("literal key matched as a pattern")
+	}
+}
+
+// withoutFlag returns a copy of the root that has to look up the universal
+// wildcard.
+func withoutFlag[T any](root *Node[T]) *Node[T] {
+	plain := *root
+	plain.wild = wildcardUnknown
+	return &plain
+}
+
+func TestMatchWithWildcards_UniversalFlag(t *testing.T) {
+	// A tree holding just the universal wildcard matches everything.
+	r := New[bool]()
+	r, _, _ = r.Insert([]byte("*"), true)
+	if r.Root().wild != wildcardUniversal {
+		t.Fatalf("expected the universal flag")
+	}
+	for _, k := range []string{"a", "tenant.abc.project", "*"} {
+		if !r.Root().MatchWithWildcards([]byte(k)) {
+			t.Fatalf("expected a match for %q", k)
+		}
+	}
+	if r.Root().MatchWithWildcards(nil) {
+		t.Fatalf("empty key shouldn't match")
+	}
+
+	// Removing it clears the flag.
+	r, _, _ = r.Insert([]byte("tenant.*"), true)
+	r, _, _ = r.Delete([]byte("*"))
+	if r.Root().wild != wildcardNone {
+		t.Fatalf("expected the universal flag to be cleared")
+	}
+	if r.Root().MatchWithWildcards([]byte("other")) || !r.Root().MatchWithWildcards([]byte("tenant.x")) {
+		t.Fatalf("bad match")
+	}
+
+	// A literal "*" isn't the universal wildcard.
+	r, _, _ = r.InsertLiteral([]byte("*"), true)
+	if r.Root().wild != wildcardNone || r.Root().MatchWithWildcards([]byte("other")) {
+		t.Fatalf("literal * set the flag")
+	}
+
+	// An uncommitted root doesn't have the flag but still matches.
+	txn := r.Txn()
+	txn.Insert([]byte("*"), true)
+	if txn.Root().wild != wildcardUnknown {
+		t.Fatalf("uncommitted root was flagged")
+	}
+	if !txn.Root().MatchWithWildcards([]byte("other")) {
+		t.Fatalf("expected a match")
+	}
+	r = txn.Commit()
+	if r.Root().wild != wildcardUniversal {
+		t.Fatalf("expected the universal flag")
+	}
+
+	// A snapshot's root is already published, so the commit after it
+	// leaves the flag alone.
+	txn = New[bool]().Txn()
+	txn.Insert([]byte("*"), true)
+	snap := txn.Snapshot()
+	if txn.Commit().Root() != snap.Root() || snap.Root().wild != wildcardUnknown {
+		t.Fatalf("published root was modified")
+	}
+	if !snap.Root().MatchWithWildcards([]byte("other")) {
+		t.Fatalf("expected a match")
+	}
+
+	// Trees built in one go are flagged too.
+	s, err := FromSlices([][]byte{[]byte("*"), []byte("b")}, []bool{true, true})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if s.Root().wild != wildcardUniversal {
+		t.Fatalf("expected the universal flag")
+	}
+}
+
+func TestMatchWithWildcards_FlagEquivalence(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		const letters = "ab.:*"
+		b := make([]byte, rnd.Intn(5))
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return b
+	}
+
+	for round := 0; round < 1000; round++ {
+		r := New[bool]()
+		for i := 0; i < rnd.Intn(6)+1; i++ {
+			p := randKey()
+			if rnd.Intn(5) == 0 {
+				r, _, _ = r.InsertLiteral(p, true)
+			} else {
+				r, _, _ = r.Insert(p, true)
+			}
+		}
+		flagged := r.Root()
+		if flagged.wild == wildcardUnknown {
+			t.Fatalf("expected a flag")
+		}
+		plain := withoutFlag(flagged)
+		for i := 0; i < 20; i++ {
+			key := randKey()
+			if got, want := flagged.MatchWithWildcards(key), plain.MatchWithWildcards(key); got != want {
+				t.Fatalf("mis-match: %q got %v want %v", key, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkMatchWithWildcards_UniversalFlag(b *testing.B) {
+	universal := New[bool]()
+	universal, _, _ = universal.Insert([]byte("*"), true)
+
+	mixed := New[bool]()
+	for _, p := range []string{
+		"tenant.abc123.*",
+		"tenant.def456.project.*",
+		"tenant.def456.project.xyz789.member.add",
+		"tenant.ghi789.project.xyz789.member.*",
+		"admin.*",
+		"billing.invoices.read",
+		"billing.invoices.*",
+		"support.tickets.*",
+	} {
+		mixed, _, _ = mixed.Insert([]byte(p), true)
+	}
+	key := []byte("tenant.ghi789.project.xyz789.member.add")
+
+	for _, bc := range []struct {
+		name string
+		root *Node[bool]
+	}{
+		{"Universal", universal.Root()},
+		{"Mixed", mixed.Root()},
+	} {
+		b.Run(bc.name+"/Flagged", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !bc.root.MatchWithWildcards(key) {
+					b.Fatalf("expected a match")
+				}
+			}
+		})
+		plain := withoutFlag(bc.root)
+		b.Run(bc.name+"/Lookup", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !plain.MatchWithWildcards(key) {
+					b.Fatalf("expected a match")
+				}
+			}
+		})
+	}
+}
+
+func TestWildcardStats(t *testing.T) {
+	r := New[int]()
+	if u, w, e := r.Root().WildcardStats(); u || w != 0 || e != 0 {
+		t.Fatalf("bad: %v %d %d", u, w, e)
+	}
+
+	for i, k := range []string{"a.*", "a.b.*", "a.b", "a", "", ".*", "a*", "a.*.b"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	if u, w, e := r.Root().WildcardStats(); u || w != 3 || e != 5 {
+		t.Fatalf("bad: %v %d %d", u, w, e)
+	}
+
+	// Literal keys are exact, however they look.
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), 0)
+	r, _, _ = r.InsertLiteral([]byte("*"), 0)
+	if u, w, e := r.Root().WildcardStats(); u || w != 3 || e != 7 {
+		t.Fatalf("bad: %v %d %d", u, w, e)
+	}
+
+	// Replacing the literal with the pattern makes it universal.
+	r, _, _ = r.Insert([]byte("*"), 0)
+	u, w, e := r.Root().WildcardStats()
+	if !u || w != 3 || e != 6 {
+		t.Fatalf("bad: %v %d %d", u, w, e)
+	}
+	if w+e+1 != r.Len() {
+		t.Fatalf("bad: %d %d %d", w, e, r.Len())
+	}
+}
+
+func TestValidateWildcardPattern(t *testing.T) {
+	for _, p := range []string{"", "*", "tenant.*", "tenant.abc.*", "a.b", "a..b", "a..*", "tenant"} {
+		if err := ValidateWildcardPattern([]byte(p)); err != nil {
+			t.Fatalf("bad: %q: %v", p, err)
+		}
+	}
+
+	cases := []struct {
+		pattern string
+		err     error
+	}{
+		{"tenant.**.x", ErrMultiLevelWildcard},
+		{"tenant.**", ErrMultiLevelWildcard},
+		{"**", ErrMultiLevelWildcard},
+		{"ten*ant", ErrWildcardMidSegment},
+		{"tenant*", ErrWildcardMidSegment},
+		{"tenant.a*", ErrWildcardMidSegment},
+		{"tenant.*a", ErrWildcardMidSegment},
+		{"*x", ErrWildcardMidSegment},
+		{"tenant.*.x", ErrWildcardNotLast},
+		{"*.example.com", ErrWildcardNotLast},
+		{"a.*.*", ErrWildcardNotLast},
+		{".*", ErrWildcardNoPrefix},
+	}
+	for _, c := range cases {
+		err := ValidateWildcardPattern([]byte(c.pattern))
+		if !errors.Is(err, c.err) {
+			t.Fatalf("bad: %q: %v", c.pattern, err)
+		}
+		if !strings.Contains(err.Error(), strconv.Quote(c.pattern)) {
+			t.Fatalf("expected the pattern in the error: %v", err)
+		}
+	}
+
+	// Every legal wildcard matches the keys it's meant to.
+	for i, p := range []string{"*", "tenant.*", "a..*"} {
+		single, _, _ := New[int]().Insert([]byte(p), i)
+		if !single.Root().MatchWithWildcards([]byte(strings.TrimSuffix(p, "*") + "x")) {
+			t.Fatalf("bad: %q", p)
+		}
+	}
+}
+
+func TestMatchWithWildcardsBatchPatterns(t *testing.T) {
+	r := New[int]()
+	for i, p := range []string{"tenant.*", "tenant.abc.*", "tenant.abc.project.x", "svc.api.*", "exact", ""} {
+		r, _, _ = r.Insert([]byte(p), i)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), 9)
+
+	cases := []struct {
+		key     string
+		pattern string
+	}{
+		{"tenant.abc.project.x", "tenant.abc.project.x"},
+		{"tenant.abc.project.y", "tenant.abc.*"},
+		{"tenant.abc", "tenant.abc.*"},
+		{"tenant.abd", "tenant.*"},
+		{"tenant", "tenant.*"},
+		{"tenants", "-"},
+		{"svc.api.read", "svc.api.*"},
+		{"svc.api.read", "svc.api.*"},
+		{"svc.other", "-"},
+		{"exact", "exact"},
+		{"exact.x", "-"},
+		{"", ""},
+		{"lit.*", "lit.*"},
+		{"lit.x", "-"},
+	}
+	keys := make([][]byte, len(cases))
+	for i, c := range cases {
+		keys[i] = []byte(c.key)
+	}
+	check := func(r *Tree[int], fix func(string) string) {
+		t.Helper()
+		got := r.Root().MatchWithWildcardsBatchPatterns(keys)
+		if len(got) != len(keys) {
+			t.Fatalf("bad: %d", len(got))
+		}
+		for i, c := range cases {
+			want := fix(c.pattern)
+			switch {
+			case want == "-" && got[i] != nil:
+				t.Fatalf("bad: %q: %q", c.key, got[i])
+			case want != "-" && (got[i] == nil || string(got[i]) != want):
+				t.Fatalf("bad: %q: %q, expected %q", c.key, got[i], want)
+			}
+			// The result always agrees with MatchWithWildcards.
+			if (got[i] != nil) != r.Root().MatchWithWildcards(keys[i]) {
+				t.Fatalf("bad: %q disagrees", c.key)
+			}
+		}
+	}
+	check(r, func(p string) string { return p })
+
+	// With the universal wildcard everything non-empty matches something.
+	r, _, _ = r.Insert([]byte("*"), 10)
+	check(r, func(p string) string {
+		if p == "-" {
+			return "*"
+		}
+		return p
+	})
+
+	// Nothing to match.
+	if got := r.Root().MatchWithWildcardsBatchPatterns(nil); len(got) != 0 {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestMatchWithWildcardsMaxDepth(t *testing.T) {
+	r := New[int]()
+	for _, p := range []string{"tenant.*", "tenant.abc.*", "tenant.abc.project.*", "svc.api.v1.*", "exact.key"} {
+		r, _, _ = r.Insert([]byte(p), 0)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), 0)
+
+	cases := []struct {
+		key    string
+		depth  int
+		expect bool
+	}{
+		// Deep patterns are ignored once the depth excludes them.
+		{"svc.api.v1.users", 3, true},
+		{"svc.api.v1.users", 2, false},
+		{"svc.api.v1", 3, true},
+		{"svc.api.v1", 2, false},
+
+		// A shallower pattern still matches when a deeper one is excluded.
+		{"tenant.abc.project.x", 3, true},
+		{"tenant.abc.project.x", 1, true},
+		{"tenant.abc", 1, true},
+		{"tenant", 1, true},
+		{"tenant", 0, false},
+
+		// Exact matches don't depend on the depth.
+		{"exact.key", -1, true},
+		{"exact.key", 0, true},
+		{"exact.key.x", 5, false},
+
+		// Literal keys are never patterns.
+		{"lit.x", 5, false},
+		{"lit.*", -1, true},
+
+		{"", 5, false},
+		{"other", 5, false},
+	}
+	for _, c := range cases {
+		if got := r.Root().MatchWithWildcardsMaxDepth([]byte(c.key), c.depth); got != c.expect {
+			t.Fatalf("bad: %q %d: %v", c.key, c.depth, got)
+		}
+	}
+
+	// The universal wildcard has depth 0.
+	r, _, _ = r.Insert([]byte("*"), 0)
+	if !r.Root().MatchWithWildcardsMaxDepth([]byte("anything.at.all"), 0) {
+		t.Fatalf("bad")
+	}
+	if r.Root().MatchWithWildcardsMaxDepth([]byte("anything.at.all"), -1) {
+		t.Fatalf("bad")
+	}
+	if r.Root().MatchWithWildcardsMaxDepth(nil, 0) {
+		t.Fatalf("bad")
+	}
+}
+
+func TestMatchWithWildcardsMaxDepth_Fuzz(t *testing.T) {
+	// With no effective limit this agrees with MatchWithWildcards.
+	rnd := rand.New(rand.NewSource(1))
+	segs := []string{"a", "b", "ab", ""}
+	gen := func() string {
+		n := rnd.Intn(4) + 1
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = segs[rnd.Intn(len(segs))]
+		}
+		return strings.Join(parts, ".")
+	}
+	for i := 0; i < 200; i++ {
+		r := New[int]()
+		for j := 0; j < 10; j++ {
+			k := gen()
+			if rnd.Intn(2) == 0 {
+				k += ".*"
+			}
+			r, _, _ = r.Insert([]byte(k), j)
+		}
+		for j := 0; j < 50; j++ {
+			k := []byte(gen())
+			if got, want := r.Root().MatchWithWildcardsMaxDepth(k, 100), r.Root().MatchWithWildcards(k); got != want {
+				t.Fatalf("bad: %q: %v, expected %v", k, got, want)
+			}
+		}
+	}
+}
+
+func TestWildcardPatterns(t *testing.T) {
+	r := New[int]()
+	if got := r.Root().WildcardPatterns(); len(got) != 0 {
+		t.Fatalf("bad: %q", got)
+	}
+
+	for _, k := range []string{"tenant.abc.*", "*", "tenant.*", "exact", "tenant.abc", "a*", "a.*.b", "svc.*", ""} {
+		r, _, _ = r.Insert([]byte(k), 0)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), 0)
+	r, _, _ = r.InsertLiteral([]byte("tenant.x.*"), 0)
+
+	var got []string
+	for _, p := range r.Root().WildcardPatterns() {
+		got = append(got, string(p))
+	}
+	if s := strings.Join(got, " "); s != "* svc.* tenant.* tenant.abc.*" {
+		t.Fatalf("bad: %q", s)
+	}
+
+	// The count agrees with WildcardStats.
+	if universal, wildcards, _ := r.Root().WildcardStats(); !universal || wildcards+1 != len(got) {
+		t.Fatalf("bad: %v %d", universal, wildcards)
+	}
+}
+
+func TestWildcardPattern(t *testing.T) {
+	cases := []struct {
+		segments []string
+		at       int
+		pattern  string
+	}{
+		{nil, 0, "*"},
+		{[]string{"tenant"}, 1, "tenant.*"},
+		{[]string{"tenant", "abc"}, 2, "tenant.abc.*"},
+		{[]string{"tenant", "abc", "project"}, 3, "tenant.abc.project.*"},
+		{[]string{"tenant", "abc"}, -1, "tenant.abc"},
+		{[]string{"exact"}, -1, "exact"},
+		{[]string{"a", ""}, 2, "a..*"},
+	}
+	for _, c := range cases {
+		p, err := WildcardPattern(c.segments, c.at)
+		if err != nil || string(p) != c.pattern {
+			t.Fatalf("bad: %q %d: %q %v", c.segments, c.at, p, err)
+		}
+		if err := ValidateWildcardPattern(p); err != nil {
+			t.Fatalf("bad: %v", err)
+		}
+
+		// Round trip back to the segments.
+		segments, at, err := ParseWildcardPattern(p)
+		if err != nil {
+			t.Fatalf("bad: %q: %v", p, err)
+		}
+		if strings.Join(segments, "|") != strings.Join(c.segments, "|") || at != c.at {
+			t.Fatalf("bad: %q: %q %d", p, segments, at)
+		}
+		if again, err := WildcardPattern(segments, at); err != nil || !bytes.Equal(again, p) {
+			t.Fatalf("bad: %q != %q: %v", again, p, err)
+		}
+	}
+
+	// Shapes that the matcher doesn't support.
+	invalid := []struct {
+		segments []string
+		at       int
+		err      error
+	}{
+		{[]string{"a", "b"}, 1, ErrWildcardNotLast},
+		{[]string{"a", "b"}, 0, ErrWildcardNotLast},
+		{[]string{"a"}, 5, ErrWildcardNotLast},
+		{[]string{"a.b"}, 1, ErrSegmentSeparator},
+		{[]string{"a*"}, 1, ErrWildcardMidSegment},
+		{[]string{"*"}, -1, ErrWildcardNotLast},
+		{[]string{"a", "*"}, 2, ErrWildcardNotLast},
+		{[]string{""}, 1, ErrWildcardNoPrefix},
+	}
+	for _, c := range invalid {
+		p, err := WildcardPattern(c.segments, c.at)
+		if !errors.Is(err, c.err) || p != nil {
+			t.Fatalf("bad: %q %d: %q %v", c.segments, c.at, p, err)
+		}
+	}
+}
+
+func TestParseWildcardPattern(t *testing.T) {
+	for _, p := range []string{"a.*.b", "ten*ant", "a.b*", "a.**", ".*", "**"} {
+		if _, _, err := ParseWildcardPattern([]byte(p)); err == nil {
+			t.Fatalf("bad: %q parsed", p)
+		}
+	}
+
+	segments, at, err := ParseWildcardPattern(nil)
+	if err != nil || len(segments) != 1 || segments[0] != "" || at != -1 {
+		t.Fatalf("bad: %q %d %v", segments, at, err)
+	}
+}
+
+func TestMatchNATS(t *testing.T) {
+	r := New[int]()
+	for _, p := range []string{"tenant.abc.>", "svc.*", "exact.key"} {
+		r, _, _ = r.Insert([]byte(p), 0)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit.>"), 0)
+
+	cases := []struct {
+		key    string
+		expect bool
+	}{
+		{"tenant.abc", true},
+		{"tenant.abc.x", true},
+		{"tenant.abc.x.y", true},
+		{"tenant.abc.", true},
+		{"tenant.abcd", false},
+		{"tenant", false},
+		{"tenant.ab", false},
+
+		// The usual patterns still apply.
+		{"svc.api.read", true},
+		{"exact.key", true},
+		{"exact.key.x", false},
+
+		// Literal keys are never patterns.
+		{"lit.x", false},
+		{"lit.>", true},
+
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := r.Root().MatchNATS([]byte(c.key)); got != c.expect {
+			t.Fatalf("bad: %q: %v", c.key, got)
+		}
+	}
+
+	// The ".>" form isn't a pattern for MatchWithWildcards.
+	if r.Root().MatchWithWildcards([]byte("tenant.abc.x")) {
+		t.Fatalf("bad")
+	}
+
+	// A lone ">" matches everything but the empty key.
+	r, _, _ = r.Insert([]byte(">"), 0)
+	if !r.Root().MatchNATS([]byte("anything")) || r.Root().MatchNATS(nil) {
+		t.Fatalf("bad")
+	}
+}
+
+func TestWildcardMatcher(t *testing.T) {
+	r := New[int]()
+	for _, p := range []string{"tenant.*", "tenant.abc.*", "tenant.abc.project.x", "svc.api.*", "exact", "ex", ""} {
+		r, _, _ = r.Insert([]byte(p), 0)
+	}
+	r, _, _ = r.InsertLiteral([]byte("lit.*"), 0)
+
+	// Feeding the key a byte at a time matches the same patterns as matching
+	// each prefix of it in one go.
+	check := func(r *Tree[int], key string) (matched bool) {
+		t.Helper()
+		m := r.Root().NewWildcardMatcher()
+		possible := true
+		for i := 0; i <= len(key); i++ {
+			if i > 0 {
+				possible = m.Advance(key[i-1])
+			}
+			prefix := []byte(key[:i])
+			want, _, _, wantOK := r.Root().MatchWithRemainder(prefix)
+			got, ok := m.Matched()
+			if ok != wantOK || !bytes.Equal(got, want) {
+				t.Fatalf("bad: %q: %q %v, expected %q %v", prefix, got, ok, want, wantOK)
+			}
+			if ok != r.Root().MatchWithWildcards(prefix) {
+				t.Fatalf("bad: %q disagrees", prefix)
+			}
+			if ok && !possible {
+				t.Fatalf("bad: %q matched after it was impossible", prefix)
+			}
+		}
+		return possible
+	}
+
+	cases := []struct {
+		key      string
+		possible bool
+	}{
+		{"tenant.abc.project.x", true},
+		{"tenant.abc.project.y", true},
+		{"tenant.abx", true},
+		{"tenantx", false},
+		{"svc.api.read", true},
+		{"svc.apx", false},
+		{"exact", true},
+		{"exactly", false},
+		{"lit.x", false},
+		{"zzz", false},
+	}
+	for _, c := range cases {
+		if got := check(r, c.key); got != c.possible {
+			t.Fatalf("bad: %q: %v", c.key, got)
+		}
+	}
+
+	// An impossible key stays impossible.
+	m := r.Root().NewWildcardMatcher()
+	for _, b := range []byte("zz") {
+		m.Advance(b)
+	}
+	if m.Advance('.') || m.Advance('*') {
+		t.Fatalf("bad")
+	}
+
+	// With the universal wildcard every non-empty key is possible.
+	r, _, _ = r.Insert([]byte("*"), 0)
+	for _, c := range cases {
+		if !check(r, c.key) {
+			t.Fatalf("bad: %q", c.key)
+		}
+	}
+}
+
+func TestWildcardMatcher_Fuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	segs := []string{"a", "b", "ab", ""}
+	gen := func() string {
+		n := rnd.Intn(4) + 1
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = segs[rnd.Intn(len(segs))]
+		}
+		return strings.Join(parts, ".")
+	}
+	for i := 0; i < 200; i++ {
+		r := New[int]()
+		for j := 0; j < 8; j++ {
+			k := gen()
+			switch rnd.Intn(3) {
+			case 0:
+				k += ".*"
+			case 1:
+				if rnd.Intn(10) == 0 {
+					k = "*"
+				}
+			}
+			r, _, _ = r.Insert([]byte(k), j)
+		}
+		for j := 0; j < 30; j++ {
+			key := gen()
+			m := r.Root().NewWildcardMatcher()
+			impossible := false
+			for k := 0; k < len(key); k++ {
+				if !m.Advance(key[k]) {
+					impossible = true
+				}
+				prefix := []byte(key[:k+1])
+				want, _, _, wantOK := r.Root().MatchWithRemainder(prefix)
+				got, ok := m.Matched()
+				if ok != wantOK || !bytes.Equal(got, want) {
+					t.Fatalf("bad: %q: %q %v, expected %q %v", prefix, got, ok, want, wantOK)
+				}
+				if ok && impossible {
+					t.Fatalf("bad: %q matched after it was impossible", prefix)
+				}
+			}
+		}
+	}
+}
+
+func TestKeysMatchingWildcard(t *testing.T) {
+	r := New[int]()
+	for _, k := range []string{
+		"", "tenant", "tenant.", "tenant.a", "tenant.b", "tenant.b.c", "tenantx", "tenant.a.*", "other.x", ".x",
+	} {
+		r, _, _ = r.Insert([]byte(k), 0)
+	}
+	r, _, _ = r.InsertLiteral([]byte("tenant.lit.*"), 0)
+
+	cases := []struct {
+		pattern string
+		expect  string
+	}{
+		{"tenant.*", "tenant tenant. tenant.a tenant.b tenant.b.c tenant.lit.*"},
+		{"tenant.b.*", "tenant.b tenant.b.c"},
+		{"tenant.a.*", "tenant.a"},
+		{"*", ".x other.x tenant tenant. tenant.a tenant.b tenant.b.c tenant.lit.* tenantx"},
+		{".*", ".x"},
+		{"tenant.a", "tenant.a"},
+		{"tenant.zzz", ""},
+		{"nope.*", ""},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, k := range r.Root().KeysMatchingWildcard([]byte(c.pattern)) {
+			// Each key is one the pattern would match.
+			p := New[int]()
+			p, _, _ = p.Insert([]byte(c.pattern), 0)
+			if !p.Root().MatchWithWildcards(k) {
+				t.Fatalf("bad: %q doesn't match %q", k, c.pattern)
+			}
+			got = append(got, string(k))
+		}
+		if s := strings.Join(got, " "); s != c.expect {
+			t.Fatalf("bad: %q: %q", c.pattern, s)
+		}
+	}
+}